@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"crypto/subtle"
+
+	"tempfunctiontools/internal/apperr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin lets requests through only with "Authorization: Bearer
+// <token>". Without a token configured the guarded endpoints are disabled.
+func RequireAdmin(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			respondError(c, apperr.Errorf(apperr.ErrUnauthorized, "the admin API is disabled, set admin.token to enable it"))
+			c.Abort()
+			return
+		}
+		key, err := bearerToken(c.GetHeader("Authorization"))
+		if err != nil || subtle.ConstantTimeCompare([]byte(key), []byte(token)) != 1 {
+			respondError(c, apperr.Errorf(apperr.ErrUnauthorized, "a valid admin token is required"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"tempfunctiontools/internal/apperr"
+	"tempfunctiontools/internal/audit"
+	"tempfunctiontools/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// approvalTTL is how long a run waits for a decision before it is dropped.
+const approvalTTL = time.Hour
+
+// pendingRun is the state needed to continue a run once its tool calls have
+// been reviewed.
+type pendingRun struct {
+	id         string
+	chatBody   models.ChatBody
+	initialMsg models.Message
+	toolCalls  []models.ToolCall
+	calls      []models.ProposedCall
+	apiKey     string
+	createdAt  time.Time
+
+	// audit ids of the request that started the run
+	conversationID string
+	requestID      string
+}
+
+func (run *pendingRun) view() *models.PendingApproval {
+	return &models.PendingApproval{
+		RunID:     run.id,
+		Status:    models.RunStatusPendingApproval,
+		Messages:  run.chatBody.Messages,
+		ToolCalls: append([]models.ProposedCall{}, run.calls...),
+	}
+}
+
+// decided reports whether every call requiring approval has a decision.
+func (run *pendingRun) decided() bool {
+	for _, call := range run.calls {
+		if call.Status == models.ApprovalPending {
+			return false
+		}
+	}
+	return true
+}
+
+func (run *pendingRun) decisions() map[string]models.ProposedCall {
+	decisions := make(map[string]models.ProposedCall, len(run.calls))
+	for _, call := range run.calls {
+		decisions[call.ID] = call
+	}
+	return decisions
+}
+
+// approvalStore keeps runs waiting for approval in memory.
+type approvalStore struct {
+	mu   sync.Mutex
+	runs map[string]*pendingRun
+}
+
+func newApprovalStore() *approvalStore {
+	return &approvalStore{runs: make(map[string]*pendingRun)}
+}
+
+func (s *approvalStore) create(ctx context.Context, chatBody models.ChatBody, initialMsg models.Message, toolCalls []models.ToolCall, apiKey string, requiresApproval func(string) bool) *models.PendingApproval {
+	run := &pendingRun{
+		id:         newRunID(),
+		chatBody:   chatBody,
+		initialMsg: initialMsg,
+		apiKey:     apiKey,
+		createdAt:  time.Now(),
+	}
+	run.conversationID, run.requestID = audit.IDs(ctx)
+
+	for i, toolCall := range toolCalls {
+		if toolCall.Id == "" {
+			toolCall.Id = fmt.Sprintf("call_%d", i)
+		}
+		run.toolCalls = append(run.toolCalls, toolCall)
+
+		var args map[string]any
+		json.Unmarshal([]byte(toolCall.Function.Arguments), &args)
+
+		call := models.ProposedCall{
+			ID:               toolCall.Id,
+			Name:             toolCall.Function.Name,
+			Arguments:        args,
+			RequiresApproval: requiresApproval(toolCall.Function.Name),
+		}
+		if call.RequiresApproval {
+			call.Status = models.ApprovalPending
+		}
+		run.calls = append(run.calls, call)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	s.runs[run.id] = run
+
+	return run.view()
+}
+
+// decide records a decision for one call, or for every pending call when
+// callID is empty. While calls are still pending it returns the updated view.
+// Once all calls are decided the run is removed from the store and returned,
+// so exactly one caller continues it.
+func (s *approvalStore) decide(runID, callID, status, reason string) (*pendingRun, *models.PendingApproval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+
+	run, ok := s.runs[runID]
+	if !ok {
+		return nil, nil, apperr.Errorf(apperr.ErrNotFound, "run %s not found", runID)
+	}
+
+	matched := false
+	for i := range run.calls {
+		call := &run.calls[i]
+		if callID != "" && call.ID != callID {
+			continue
+		}
+		if !call.RequiresApproval {
+			if callID != "" {
+				return nil, nil, apperr.Invalid("tool_call_id", "tool call %s does not require approval", callID)
+			}
+			continue
+		}
+		if call.Status != models.ApprovalPending {
+			if callID != "" {
+				return nil, nil, apperr.Errorf(apperr.ErrConflict, "tool call %s is already %s", callID, call.Status)
+			}
+			continue
+		}
+		call.Status = status
+		call.Reason = reason
+		matched = true
+	}
+
+	if !matched {
+		if callID != "" {
+			return nil, nil, apperr.Errorf(apperr.ErrNotFound, "tool call %s not found in run %s", callID, runID)
+		}
+		return nil, nil, apperr.Errorf(apperr.ErrConflict, "run %s has no pending tool calls", runID)
+	}
+
+	if !run.decided() {
+		return nil, run.view(), nil
+	}
+
+	delete(s.runs, runID)
+	return run, nil, nil
+}
+
+// expire drops runs older than approvalTTL. The caller holds the lock.
+func (s *approvalStore) expire() {
+	for id, run := range s.runs {
+		if time.Since(run.createdAt) > approvalTTL {
+			log.Printf("run %s expired waiting for approval", id)
+			delete(s.runs, id)
+		}
+	}
+}
+
+func newRunID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (ctrl *ChatController) requiresApproval(name string) bool {
+	tool, err := ctrl.agent.Tools.Get(name)
+	return err == nil && tool.RequiresApproval
+}
+
+func (ctrl *ChatController) needsApproval(toolCalls []models.ToolCall) bool {
+	for _, toolCall := range toolCalls {
+		if ctrl.requiresApproval(toolCall.Function.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApproveToolCall approves a held tool call, or all of them, and continues
+// the run once nothing is pending.
+func (ctrl *ChatController) ApproveToolCall(c *gin.Context) {
+	ctrl.decideToolCall(c, models.ApprovalApproved)
+}
+
+// RejectToolCall rejects a held tool call, or all of them. The rejection and
+// its reason are passed back to the model as the tool result.
+func (ctrl *ChatController) RejectToolCall(c *gin.Context) {
+	ctrl.decideToolCall(c, models.ApprovalRejected)
+}
+
+func (ctrl *ChatController) decideToolCall(c *gin.Context, status string) {
+	decision := models.ApprovalDecision{}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&decision); err != nil {
+			badRequest(c, "", err)
+			return
+		}
+	}
+
+	runID := c.Param("id")
+	run, pending, err := ctrl.approvals.decide(runID, decision.ToolCallID, status, decision.Reason)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	log.Printf("run %s: tool call %q %s", runID, decision.ToolCallID, status)
+
+	if pending != nil {
+		c.JSON(http.StatusAccepted, pending)
+		return
+	}
+
+	ctx := withAPIKey(audit.WithIDs(c.Request.Context(), run.conversationID, run.requestID), run.apiKey)
+
+	toolResults := ctrl.executeToolCalls(ctx, run.toolCalls, run.decisions())
+	messages, err := ctrl.completeQuery(ctx, run.chatBody, run.initialMsg, toolResults)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, messages)
+}
@@ -5,10 +5,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"tempfunctiontools/internal/apperr"
+	"tempfunctiontools/internal/audit"
+	"tempfunctiontools/internal/config"
 	"tempfunctiontools/internal/database"
 	"tempfunctiontools/internal/functions"
 	"tempfunctiontools/models"
@@ -16,122 +21,103 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	requestIDHeader      = "X-Request-ID"
+	conversationIDHeader = "X-Conversation-ID"
+
+	// llmService names the LLM API in upstream errors.
+	llmService = "openrouter"
+)
+
 type ChatController struct {
-	ctx    context.Context
-	db     *database.DbConfig
-	agent  *models.Agent
-	apiKey string
+	ctx       context.Context
+	db        *database.DbConfig
+	agent     *models.Agent
+	approvals *approvalStore
+	config    *config.Config
 }
 
-func NewChatController(ctx context.Context, agent *models.Agent, db *database.DbConfig) *ChatController {
+func NewChatController(ctx context.Context, agent *models.Agent, db *database.DbConfig, cfg *config.Config) *ChatController {
 	agent.Db = db
+	agent.Audit = audit.NewLogger(db, cfg.Audit)
 	functions.RegisterTools(agent)
+	functions.RegisterQueryTool(agent, cfg.QueryDatabase)
 
 	return &ChatController{
-		ctx:   ctx,
-		db:    db,
-		agent: agent,
+		ctx:       ctx,
+		db:        db,
+		agent:     agent,
+		approvals: newApprovalStore(),
+		config:    cfg,
 	}
 }
 
 func (ctrl *ChatController) GetChat(c *gin.Context) {
-	apiKey := c.Request.Header.Get("Authorization")
-	apiKey = apiKey[7:]
+	apiKey, err := bearerToken(c.GetHeader("Authorization"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
 
 	chatBody := models.ChatBody{}
 
 	if err := c.ShouldBindJSON(&chatBody); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(c, "", err)
 		return
 	}
-	log.Println(apiKey)
 	log.Println(chatBody)
 
-	ctrl.apiKey = apiKey
+	ctx := withAPIKey(withAuditIDs(c), apiKey)
 
-	returnMessages, err := ctrl.ProcessQuery(c, chatBody)
+	returnMessages, pending, err := ctrl.ProcessQuery(ctx, chatBody)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
+		return
+	}
+
+	if pending != nil {
+		c.JSON(http.StatusAccepted, pending)
 		return
 	}
 
 	c.JSON(http.StatusOK, returnMessages)
 }
 
-func (ctrl *ChatController) GetChat1(c *gin.Context, agent *models.Agent) {
-	apiKey := c.Request.Header.Get("Authorization")
-	apiKey = apiKey[7:]
+// withAuditIDs returns the request context with the conversation and request
+// IDs recorded in the tool call audit log. A missing request ID is generated
+// and echoed in the response.
+func withAuditIDs(c *gin.Context) context.Context {
+	requestID := c.GetHeader(requestIDHeader)
+	if requestID == "" {
+		requestID = newRunID()
+	}
+	c.Header(requestIDHeader, requestID)
+	return audit.WithIDs(c.Request.Context(), c.GetHeader(conversationIDHeader), requestID)
+}
 
-	chatBody := models.ChatBody{}
+type apiKeyKey struct{}
 
-	if err := c.ShouldBindJSON(&chatBody); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	log.Println(apiKey)
-	log.Println(chatBody)
+// withAPIKey returns a context carrying the caller's LLM API key. The key
+// travels with each request rather than on the shared controller, so
+// concurrent chats never use each other's key.
+func withAPIKey(ctx context.Context, apiKey string) context.Context {
+	return context.WithValue(ctx, apiKeyKey{}, apiKey)
+}
 
-	chatBody.Tools = functions.GetTools(ctrl.agent)
-
-	// chatBody.Messages = append([]models.Message{
-	// 	{
-	// 		Role:    "system",
-	// 		Content: "You have access to the following tools: get_revenue_by_month_and_year. Always use these tools when applicable.",
-	// 	},
-	// }, chatBody.Messages...)
-
-	for _, toolCall := range chatBody.Tools {
-		if toolCall.Function.Name == "get_quarterly_revenue" {
-
-			if toolCall.Function.Description == "" {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Function arguments are missing"})
-				return
-			}
-			// Ensure parameters are parsed correctly
-			var args map[string]int
-			jsonBytes, err := json.Marshal(toolCall.Function.Description)
-
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid function arguments"})
-				return
-			}
-			if err := json.Unmarshal(jsonBytes, &args); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid function arguments"})
-				return
-			}
-
-			quarter, quarterOk := args["quarter"]
-			year, yearOk := args["year"]
-			if !quarterOk || !yearOk {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Missing quarter or year argument"})
-				return
-			}
-
-			// Get revenue for the requested quarter
-			revenue, err := ctrl.GetQuarterlyRevenueInternal(quarter, year)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-
-			// Return the revenue response
-			c.JSON(http.StatusOK, gin.H{
-				"tool":    "get_quarterly_revenue",
-				"quarter": quarter,
-				"year":    year,
-				"revenue": revenue,
-			})
-			return
-		}
-	}
+// apiKeyFrom returns the LLM API key of the request.
+func apiKeyFrom(ctx context.Context) string {
+	apiKey, _ := ctx.Value(apiKeyKey{}).(string)
+	return apiKey
+}
 
-	// Otherwise, forward request to LLM
-	response, err := ctrl.callLLM(ctrl.ctx, chatBody)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+// bearerToken returns the key of an "Authorization: Bearer <key>" header.
+func bearerToken(header string) (string, error) {
+	scheme, token, _ := strings.Cut(strings.TrimSpace(header), " ")
+	token = strings.TrimSpace(token)
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", apperr.Errorf(apperr.ErrUnauthorized, "the Authorization header must be Bearer <api key>")
 	}
-	c.JSON(http.StatusOK, response)
+	return token, nil
 }
 
 func (ctrl *ChatController) callLLM(ctx context.Context, chatBody models.ChatBody) (models.ChatResponse, error) {
@@ -155,18 +141,24 @@ func (ctrl *ChatController) callLLM(ctx context.Context, chatBody models.ChatBod
 		log.Fatal(err)
 	}
 	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "Bearer "+ctrl.apiKey)
+	req.Header.Add("Authorization", "Bearer "+apiKeyFrom(ctx))
 
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("error calling LLM: %v", err)
-		return responseBody, err
+		return responseBody, apperr.Upstream(llmService, 0, err)
 	}
 
 	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		log.Printf("LLM returned status %d: %s", resp.StatusCode, data)
+		return responseBody, apperr.Upstream(llmService, resp.StatusCode,
+			fmt.Errorf("LLM returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(data))))
+	}
 	if err := json.NewDecoder(resp.Body).Decode(&responseBody); err != nil {
 		log.Printf("error decoding response: %v", err)
-		return responseBody, err
+		return responseBody, apperr.Upstream(llmService, resp.StatusCode, fmt.Errorf("failed to decode LLM response: %w", err))
 	}
 
 	log.Printf("responseBody: %+v", responseBody)
@@ -311,23 +303,17 @@ func (ctrl *ChatController) callLLM(ctx context.Context, chatBody models.ChatBod
 
 func (ctrl *ChatController) GetRevenue(c *gin.Context) {
 	// extract month and year from the path parameters
-	month, err := strconv.Atoi(c.Param("month"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid month"})
-		return
-	}
-	year, err := strconv.Atoi(c.Param("year"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid year"})
+	month, year, ok := monthYearParams(c)
+	if !ok {
 		return
 	}
 
 	log.Printf("month: %d, year: %d", month, year)
 
-	// get the revenue
-	rev, err := ctrl.db.GetRevenueByMonthYear(month, year)
+	// get the revenue; a month without rows is ErrRevenueNotFound, a 404
+	rev, err := ctrl.db.GetRevenueByMonthYear(month, year, database.RevenueFilter{})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get revenue"})
+		respondError(c, err)
 		return
 	}
 
@@ -336,67 +322,72 @@ func (ctrl *ChatController) GetRevenue(c *gin.Context) {
 
 func NewAgent(systemMsg string, maxRetries int, db *database.DbConfig) *models.Agent {
 	return &models.Agent{
-		Tools:      make(map[string]models.Tool),
+		Tools:      models.NewToolRegistry(),
 		SystemMsg:  systemMsg,
 		MaxRetries: maxRetries,
 		Db:         db,
 	}
 }
 
+// GetQuarterlyRevenue returns the total revenue of a quarter in the original
+// {quarter, year, revenue} shape. The region, product_line, channel and
+// currency query parameters narrow and convert the total.
 func (ctrl *ChatController) GetQuarterlyRevenue(c *gin.Context) {
+	revenue, ok := ctrl.quarterlyRevenue(c, false)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"quarter": revenue.Quarter,
+		"year":    revenue.Year,
+		"revenue": revenue.Revenue,
+	})
+}
+
+// GetQuarterlyRevenueV2 returns the quarter with its currency, months,
+// missing months and, with group_by, per-group totals.
+func (ctrl *ChatController) GetQuarterlyRevenueV2(c *gin.Context) {
+	revenue, ok := ctrl.quarterlyRevenue(c, true)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, revenue)
+}
+
+// quarterlyRevenue reads the quarter from the :quarter and :year path
+// parameters and the query, writing an error response on failure.
+func (ctrl *ChatController) quarterlyRevenue(c *gin.Context, groupable bool) (*database.QuarterRevenue, bool) {
 	// Extract quarter and year from the path parameters
 	quarterStr := c.Param("quarter")
 	yearStr := c.Param("year")
 
 	quarter, err := strconv.Atoi(quarterStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid quarter"})
-		return
+		respondError(c, apperr.Invalid("quarter", "invalid quarter %q", quarterStr))
+		return nil, false
 	}
 	year, err := strconv.Atoi(yearStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid year"})
-		return
+		respondError(c, apperr.Invalid("year", "invalid year %q", yearStr))
+		return nil, false
 	}
 
-	// Get revenue for the requested quarter
-	revenue, err := ctrl.GetQuarterlyRevenueInternal(quarter, year)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	filter, groupBy, ok := dimensionParams(c)
+	if !ok {
+		return nil, false
 	}
-
-	// Return the revenue response
-	c.JSON(http.StatusOK, gin.H{
-		"quarter": quarter,
-		"year":    year,
-		"revenue": revenue,
-	})
-}
-
-func (ctrl *ChatController) GetQuarterlyRevenueInternal(quarter, year int) (float64, error) {
-	// Map quarters to months
-	quarterMonths := map[int][]int{
-		1: {1, 2, 3},
-		2: {4, 5, 6},
-		3: {7, 8, 9},
-		4: {10, 11, 12},
+	if !groupable {
+		groupBy = nil
 	}
 
-	months, exists := quarterMonths[quarter]
-	if !exists {
-		return 0, fmt.Errorf("invalid quarter: %d", quarter)
-	}
-
-	totalRevenue := 0.0
-	for _, month := range months {
-		revenue, err := ctrl.db.GetRevenueByMonthYear(month, year)
-		if err != nil && err.Error() != fmt.Sprintf("no revenue found for month %d and year %d", month, year) {
-			return 0, err
-		}
-		if revenue != nil {
-			totalRevenue += revenue.Amount
-		}
+	// Get revenue for the requested quarter, the same query the
+	// get_quarterly_revenue tool uses
+	revenue, err := ctrl.db.QuarterlyRevenue(c.Request.Context(), quarter, year, filter, groupBy, c.Query("currency"))
+	if err != nil {
+		respondError(c, err)
+		return nil, false
 	}
-	return totalRevenue, nil
+	return revenue, true
 }
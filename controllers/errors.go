@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"tempfunctiontools/internal/apperr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondError answers with the status and body apperr maps err to: the
+// message, a code such as not_found and, for validation errors, the field.
+// Server-side failures are logged.
+func respondError(c *gin.Context, err error) {
+	respondErrorWith(c, err, nil)
+}
+
+// respondErrorWith is respondError with more fields in the body, e.g. the
+// errors of single rows.
+func respondErrorWith(c *gin.Context, err error, fields gin.H) {
+	status := apperr.Status(err)
+	if status >= http.StatusInternalServerError {
+		log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+	}
+	body := apperr.Response(err)
+	for key, value := range fields {
+		body[key] = value
+	}
+	c.JSON(status, body)
+}
+
+// badRequest answers 400 for input that could not be read, e.g. a malformed
+// body, whatever the kind of err.
+func badRequest(c *gin.Context, field string, err error) {
+	respondError(c, apperr.Invalid(field, "%v", err))
+}
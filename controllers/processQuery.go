@@ -5,19 +5,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"tempfunctiontools/internal/functions"
+	"tempfunctiontools/internal/apperr"
+	"tempfunctiontools/internal/audit"
+	"tempfunctiontools/internal/database"
 	"tempfunctiontools/models"
+	"time"
 )
 
-func (ctrl *ChatController) ProcessQuery(ctx context.Context, chatBody models.ChatBody) ([]models.Message, error) {
-	// add tool calls
-	chatBody.Tools = functions.GetTools(ctrl.agent)
+func (ctrl *ChatController) ProcessQuery(ctx context.Context, chatBody models.ChatBody) ([]models.Message, *models.PendingApproval, error) {
+	// add tool calls, only the relevant ones when retrieval is enabled
+	chatBody.Tools = ctrl.selectTools(chatBody.Messages)
 
 	messages := chatBody.Messages
 
 	initialResponse, err := ctrl.createInitialCompletion(ctx, chatBody)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	log.Printf("initialResponse: %+v", initialResponse)
@@ -31,7 +34,7 @@ func (ctrl *ChatController) ProcessQuery(ctx context.Context, chatBody models.Ch
 		}
 
 		messages = append(messages, msg)
-		return messages, nil
+		return messages, nil, nil
 		// return messages, fmt.Errorf("no choices in initial response")
 	}
 
@@ -42,25 +45,69 @@ func (ctrl *ChatController) ProcessQuery(ctx context.Context, chatBody models.Ch
 	// if no tool calls, add initial response
 	if len(initialResponse.Choices[0].Message.ToolCalls) == 0 {
 		messages = append(messages, initialMsg)
-		return messages, nil
+		return messages, nil, nil
+	}
+
+	toolCalls := initialResponse.Choices[0].Message.ToolCalls
+
+	// hold the run until a reviewer decides on sensitive calls
+	if ctrl.needsApproval(toolCalls) {
+		pending := ctrl.approvals.create(ctx, chatBody, initialMsg, toolCalls, apiKeyFrom(ctx), ctrl.requiresApproval)
+		log.Printf("run %s is waiting for approval", pending.RunID)
+		return nil, pending, nil
 	}
 
 	// execute tool calls
+	toolResults := ctrl.executeToolCalls(ctx, toolCalls, nil)
+
+	messages, err = ctrl.completeQuery(ctx, chatBody, initialMsg, toolResults)
+	return messages, nil, err
+}
+
+// executeToolCalls runs the tool calls in order. Calls rejected by a reviewer
+// are not run; the rejection is handed back to the model as their result.
+func (ctrl *ChatController) executeToolCalls(ctx context.Context, toolCalls []models.ToolCall, decisions map[string]models.ProposedCall) []models.Message {
 	var toolResults []models.Message
 
-	toolCalls := initialResponse.Choices[0].Message.ToolCalls
 	for _, toolCall := range toolCalls {
-		result, err := ctrl.executeToolCall(ctx, toolCall)
+		if decision, ok := decisions[toolCall.Id]; ok && decision.Status == models.ApprovalRejected {
+			content := fmt.Sprintf("Error: the call to %s was rejected by a reviewer", toolCall.Function.Name)
+			if decision.Reason != "" {
+				content += ": " + decision.Reason
+			}
+			toolResults = append(toolResults, models.Message{
+				Role:    models.ChatMessageRoleUser,
+				Content: content,
+			})
+			ctrl.agent.Audit.Record(ctx, ctrl.agent.AuditEntry(toolCall, audit.Entry{
+				Result:  content,
+				Status:  database.ToolCallRejected,
+				Started: time.Now(),
+			}))
+			continue
+		}
+
+		approved := decisions[toolCall.Id].Status == models.ApprovalApproved
+		result, err := ctrl.executeToolCall(ctx, toolCall, approved)
 		if err != nil {
-			// return nil, err
+			// the kind of failure tells the model whether to fix the
+			// arguments, retry later or give up
 			result = models.Message{
 				Role:    models.ChatMessageRoleUser,
-				Content: "Error: " + err.Error(),
+				Content: apperr.ToolMessage(err),
 			}
 		}
 		toolResults = append(toolResults, result)
 	}
 
+	return toolResults
+}
+
+// completeQuery sends the tool results back to the LLM and appends its final
+// answer to the conversation.
+func (ctrl *ChatController) completeQuery(ctx context.Context, chatBody models.ChatBody, initialMsg models.Message, toolResults []models.Message) ([]models.Message, error) {
+	messages := chatBody.Messages
+
 	// create final response
 	finalResponse, err := ctrl.createFinalResponse(ctx, chatBody, initialMsg, toolResults)
 	if err != nil {
@@ -74,7 +121,7 @@ func (ctrl *ChatController) ProcessQuery(ctx context.Context, chatBody models.Ch
 			Content: "No response from LLM",
 		}
 		messages = append(messages, msg)
-		return messages, fmt.Errorf("no choices in final response")
+		return messages, apperr.Errorf(apperr.ErrUpstream, "no choices in final response")
 	}
 
 	// add final response
@@ -89,6 +136,8 @@ func (ctrl *ChatController) ProcessQuery(ctx context.Context, chatBody models.Ch
 
 // createInitialCompletion sends the query to the LLM and gets the initial response
 func (ctrl *ChatController) createInitialCompletion(ctx context.Context, chatBody models.ChatBody) (models.ChatResponse, error) {
+	chatBody = ctrl.withExamples(chatBody)
+
 	resp, err := ctrl.callLLM(ctx, chatBody)
 	if err != nil {
 		log.Printf("error calling LLM: %v", err)
@@ -98,28 +147,14 @@ func (ctrl *ChatController) createInitialCompletion(ctx context.Context, chatBod
 	return resp, nil
 }
 
-// executeToolCall sends the tool call to the LLM and gets the response
-func (ctrl *ChatController) executeToolCall(ctx context.Context, toolCall models.ToolCall) (models.Message, error) {
-	// get function name and args
+// executeToolCall runs the tool call and returns its result as a message
+// for the LLM. approved says whether a reviewer approved the call.
+func (ctrl *ChatController) executeToolCall(ctx context.Context, toolCall models.ToolCall, approved bool) (models.Message, error) {
 	functionName := toolCall.Function.Name
-	arguments := toolCall.Function.Arguments
-
-	log.Printf("Function name: %s, Arguments: %v", functionName, arguments)
-	var args map[string]any
-	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
-		log.Printf("error unmarshalling arguments: %v", err)
-		return models.Message{}, err
-	}
 
-	log.Printf("Arguments: %+v", args)
+	log.Printf("Function name: %s, Arguments: %v", functionName, toolCall.Function.Arguments)
 	// call function
-	tool, exists := ctrl.agent.Tools[functionName]
-	if !exists {
-		log.Printf("tool %s not found", functionName)
-		return models.Message{}, fmt.Errorf("tool %s not found", functionName)
-	}
-
-	result, err := tool.Execute(args)
+	result, err := ctrl.agent.CallTool(ctx, toolCall, approved)
 	if err != nil {
 		log.Printf("error executing tool: %v", err)
 		return models.Message{}, err
@@ -132,6 +167,9 @@ func (ctrl *ChatController) executeToolCall(ctx context.Context, toolCall models
 		return models.Message{}, err
 	}
 
+	// keep oversized results out of the prompt
+	resultJSON = ctrl.limitResult(ctx, functionName, resultJSON)
+
 	resp := models.Message{
 		Role:    models.ChatMessageRoleUser,
 		Content: string(resultJSON),
@@ -162,3 +200,34 @@ func (ctrl *ChatController) createFinalResponse(ctx context.Context, chatBody mo
 
 	return response, nil
 }
+
+// withExamples renders the tools' usage examples where the model's provider
+// expects them: in each tool description or in a system message. Only the
+// copy sent to the LLM changes, the returned conversation does not.
+func (ctrl *ChatController) withExamples(chatBody models.ChatBody) models.ChatBody {
+	switch ctrl.config.Examples.PlacementFor(chatBody.Model) {
+	case models.ExamplesInDescription:
+		tools := make([]models.Tool, 0, len(chatBody.Tools))
+		for _, tool := range chatBody.Tools {
+			tools = append(tools, tool.WithExamplesInDescription())
+		}
+		chatBody.Tools = tools
+	case models.ExamplesInSystem:
+		prompt := models.ExamplesPrompt(chatBody.Tools)
+		if prompt == "" {
+			break
+		}
+		messages := make([]models.Message, 0, len(chatBody.Messages)+1)
+		if len(chatBody.Messages) > 0 && chatBody.Messages[0].Role == models.ChatMessageRoleSystem {
+			system := chatBody.Messages[0]
+			system.Content += "\n\n" + prompt
+			messages = append(messages, system)
+			messages = append(messages, chatBody.Messages[1:]...)
+		} else {
+			messages = append(messages, models.Message{Role: models.ChatMessageRoleSystem, Content: prompt})
+			messages = append(messages, chatBody.Messages...)
+		}
+		chatBody.Messages = messages
+	}
+	return chatBody
+}
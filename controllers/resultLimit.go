@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"tempfunctiontools/internal/results"
+	"tempfunctiontools/models"
+)
+
+// maxSummaryInput caps how much of an oversized result is sent for
+// summarization.
+const maxSummaryInput = 256 * 1024
+
+const summaryPrompt = "Summarize the following tool result for another assistant. " +
+	"Keep every figure, name and date needed to answer questions about it. Reply with the summary only."
+
+// limitResult enforces the tool's result limit. Oversized results are either
+// summarized by a model or truncated; both tell the model it is seeing
+// partial data.
+func (ctrl *ChatController) limitResult(ctx context.Context, toolName string, resultJSON []byte) []byte {
+	if ctrl.config == nil {
+		return resultJSON
+	}
+
+	toolLimit := ctrl.config.Results.Limit(toolName)
+	limit := results.Limit{MaxBytes: toolLimit.MaxBytes, MaxTokens: toolLimit.MaxTokens}
+	if !results.Exceeds(resultJSON, limit) {
+		return resultJSON
+	}
+
+	log.Printf("result of %s is %d bytes, over the limit of %d", toolName, len(resultJSON), limit.Bytes())
+
+	var partial *results.Partial
+	if toolLimit.Summarize && ctrl.config.Results.SummaryModel != "" {
+		summary, err := ctrl.summarizeResult(ctx, toolName, resultJSON)
+		if err != nil {
+			log.Printf("error summarizing result of %s, truncating instead: %v", toolName, err)
+		} else {
+			partial = &results.Partial{
+				Truncated:     true,
+				OriginalBytes: len(resultJSON),
+				Summary:       summary,
+				Note:          fmt.Sprintf("Partial data: this is a model-written summary of a %d-byte result, not the full data.", len(resultJSON)),
+			}
+		}
+	}
+	if partial == nil {
+		partial = results.Truncate(resultJSON, limit)
+	}
+
+	var result any = partial
+	if !partial.Truncated {
+		// it fits without whitespace, nothing needs wrapping
+		result = partial.Result
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("error marshalling partial result: %v", err)
+		return resultJSON
+	}
+	return data
+}
+
+func (ctrl *ChatController) summarizeResult(ctx context.Context, toolName string, resultJSON []byte) (string, error) {
+	input := string(resultJSON)
+	if len(input) > maxSummaryInput {
+		input = input[:maxSummaryInput]
+	}
+
+	chatBody := models.ChatBody{
+		Model: ctrl.config.Results.SummaryModel,
+		Messages: []models.Message{
+			{Role: models.ChatMessageRoleSystem, Content: summaryPrompt},
+			{Role: models.ChatMessageRoleUser, Content: fmt.Sprintf("Result of %s:\n%s", toolName, input)},
+		},
+	}
+
+	response, err := ctrl.callLLM(ctx, chatBody)
+	if err != nil {
+		return "", err
+	}
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("no choices in summary response")
+	}
+
+	summary := strings.TrimSpace(response.Choices[0].Message.Content)
+	if summary == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return summary, nil
+}
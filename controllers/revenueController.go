@@ -0,0 +1,451 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tempfunctiontools/internal/apperr"
+	"tempfunctiontools/internal/database"
+	"tempfunctiontools/internal/revenueio"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxBulkRevenues caps the rows accepted by one bulk upsert.
+	maxBulkRevenues = 10000
+	// maxImportBytes caps the size of an uploaded import file.
+	maxImportBytes = 32 << 20
+
+	importUpsert  = "upsert"
+	importReplace = "replace"
+)
+
+// RevenueController lets the revenue table be maintained over REST instead
+// of only through the seed data.
+type RevenueController struct {
+	db *database.DbConfig
+}
+
+func NewRevenueController(db *database.DbConfig) *RevenueController {
+	return &RevenueController{db: db}
+}
+
+// revenueRequest is the body of create, update and bulk requests. Pointers
+// tell missing fields from zero values.
+type revenueRequest struct {
+	Month  *int     `json:"month"`
+	Year   *int     `json:"year"`
+	Amount *float64 `json:"amount"`
+
+	Currency    string `json:"currency"`
+	Region      string `json:"region"`
+	ProductLine string `json:"product_line"`
+	Channel     string `json:"channel"`
+}
+
+func (r revenueRequest) revenue() (database.Revenue, error) {
+	switch {
+	case r.Month == nil:
+		return database.Revenue{}, apperr.Invalid("month", "month is required")
+	case r.Year == nil:
+		return database.Revenue{}, apperr.Invalid("year", "year is required")
+	case r.Amount == nil:
+		return database.Revenue{}, apperr.Invalid("amount", "amount is required")
+	}
+	revenue := database.Revenue{
+		Month:       *r.Month,
+		Year:        *r.Year,
+		Amount:      *r.Amount,
+		Currency:    database.CurrencyOrDefault(r.Currency),
+		Region:      strings.TrimSpace(r.Region),
+		ProductLine: strings.TrimSpace(r.ProductLine),
+		Channel:     strings.TrimSpace(r.Channel),
+	}
+	return revenue, revenue.Validate()
+}
+
+// rowError reports an invalid row of a bulk request.
+type rowError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// CreateRevenue adds the revenue of a month that has none yet.
+func (ctrl *RevenueController) CreateRevenue(c *gin.Context) {
+	var req revenueRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, "", err)
+		return
+	}
+	revenue, err := req.revenue()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if err := ctrl.db.CreateRevenue(c.Request.Context(), &revenue); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	log.Printf("created revenue %d/%d: %v", revenue.Month, revenue.Year, revenue.Amount)
+	c.JSON(http.StatusCreated, revenue)
+}
+
+// UpdateRevenue replaces the amount, and the currency when given, of an
+// existing row. Segmented rows are picked with the region, product_line and
+// channel query parameters.
+func (ctrl *RevenueController) UpdateRevenue(c *gin.Context) {
+	key, ok := revenueKeyParams(c)
+	if !ok {
+		return
+	}
+	month, year := key.Month, key.Year
+
+	var req revenueRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, "", err)
+		return
+	}
+	if (req.Month != nil && *req.Month != month) || (req.Year != nil && *req.Year != year) {
+		respondError(c, apperr.Invalid("month", "month and year in the body must match the path"))
+		return
+	}
+	req.Month, req.Year = &month, &year
+
+	revenue, err := req.revenue()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	currency := ""
+	if req.Currency != "" {
+		currency = revenue.Currency
+	}
+
+	updated, err := ctrl.db.UpdateRevenue(c.Request.Context(), key, revenue.Amount, currency)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	log.Printf("updated revenue %d/%d: %v", month, year, updated.Amount)
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteRevenue removes one row, picked like in UpdateRevenue.
+func (ctrl *RevenueController) DeleteRevenue(c *gin.Context) {
+	key, ok := revenueKeyParams(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.db.DeleteRevenue(c.Request.Context(), key); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	log.Printf("deleted revenue for %s", key)
+	c.Status(http.StatusNoContent)
+}
+
+// BulkUpsertRevenue creates or replaces many months at once. The body is a
+// JSON array of rows. Nothing is written unless every row is valid.
+func (ctrl *RevenueController) BulkUpsertRevenue(c *gin.Context) {
+	var reqs []revenueRequest
+	if err := c.ShouldBindJSON(&reqs); err != nil {
+		badRequest(c, "", err)
+		return
+	}
+	if len(reqs) == 0 {
+		respondError(c, apperr.Invalid("", "no revenues given"))
+		return
+	}
+	if len(reqs) > maxBulkRevenues {
+		respondError(c, apperr.Errorf(apperr.ErrTooLarge, "at most %d revenues per request", maxBulkRevenues))
+		return
+	}
+
+	revenues := make([]database.Revenue, 0, len(reqs))
+	seen := make(map[database.RevenueKey]int, len(reqs))
+	var rowErrors []rowError
+	for i, req := range reqs {
+		revenue, err := req.revenue()
+		if err != nil {
+			rowErrors = append(rowErrors, rowError{Index: i, Error: err.Error()})
+			continue
+		}
+		key := revenue.Key()
+		if first, exists := seen[key]; exists {
+			rowErrors = append(rowErrors, rowError{Index: i, Error: fmt.Sprintf("duplicate of row %d", first)})
+			continue
+		}
+		seen[key] = i
+		revenues = append(revenues, revenue)
+	}
+	if len(rowErrors) > 0 {
+		respondErrorWith(c, apperr.New(apperr.ErrUnprocessable, "invalid revenues"), gin.H{"rows": rowErrors})
+		return
+	}
+
+	if err := ctrl.db.UpsertRevenues(revenues); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	log.Printf("upserted %d revenues", len(revenues))
+	c.JSON(http.StatusOK, gin.H{"upserted": len(revenues)})
+}
+
+// ImportRevenue loads revenues from a CSV or JSON body. The format comes
+// from ?format= or the Content-Type. mode=upsert (default) adds or replaces
+// the given months, mode=replace swaps the whole table for the file.
+// dry_run=true only validates. Nothing is written unless every row is valid;
+// invalid rows are listed with their line or position.
+func (ctrl *RevenueController) ImportRevenue(c *gin.Context) {
+	format := requestFormat(c, c.ContentType())
+	mode := c.DefaultQuery("mode", importUpsert)
+	if mode != importUpsert && mode != importReplace {
+		respondError(c, apperr.Invalid("mode", "unknown mode %q, use upsert or replace", mode))
+		return
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		respondError(c, apperr.Invalid("dry_run", "invalid dry_run"))
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	rows, err := revenueio.Parse(body, format)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(c, apperr.Errorf(apperr.ErrTooLarge, "import is larger than %d bytes", maxImportBytes))
+			return
+		}
+		badRequest(c, "", err)
+		return
+	}
+	revenues, rowErrors := revenueio.Split(rows)
+
+	report := gin.H{
+		"mode":    mode,
+		"dry_run": dryRun,
+		"total":   len(rows),
+		"valid":   len(revenues),
+		"invalid": len(rowErrors),
+		"errors":  rowErrors,
+	}
+	if len(rowErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, report)
+		return
+	}
+	if dryRun {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	if mode == importReplace {
+		err = ctrl.db.ReplaceRevenues(c.Request.Context(), revenues)
+	} else if len(revenues) > 0 {
+		err = ctrl.db.UpsertRevenues(revenues)
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	log.Printf("imported %d revenues (%s)", len(revenues), mode)
+	report["imported"] = len(revenues)
+	c.JSON(http.StatusOK, report)
+}
+
+// ExportRevenue streams every revenue row as CSV or JSON, chosen by
+// ?format= or the Accept header.
+func (ctrl *RevenueController) ExportRevenue(c *gin.Context) {
+	format := requestFormat(c, c.GetHeader("Accept"))
+	contentType := "application/json"
+	if format == revenueio.FormatCSV {
+		contentType = "text/csv"
+	}
+
+	writer, err := revenueio.NewWriter(c.Writer, format)
+	if err != nil {
+		badRequest(c, "format", err)
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=revenue.%s", format))
+	c.Status(http.StatusOK)
+
+	// the status is already sent, a failure can only cut the stream short
+	err = ctrl.db.EachRevenue(c.Request.Context(), func(revenue database.Revenue) error {
+		return writer.Write(revenue)
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		log.Printf("revenue export failed: %v", err)
+	}
+}
+
+// GetRevenueSummary aggregates revenue between ?start= and ?end=, both
+// YYYY-MM and inclusive, filtered and grouped like dimensionParams reads and
+// converted to ?currency= when given.
+func (ctrl *RevenueController) GetRevenueSummary(c *gin.Context) {
+	from, err := database.ParseYearMonth(c.Query("start"))
+	if err != nil {
+		respondError(c, apperr.Invalid("start", "start: %v", err))
+		return
+	}
+	to, err := database.ParseYearMonth(c.Query("end"))
+	if err != nil {
+		respondError(c, apperr.Invalid("end", "end: %v", err))
+		return
+	}
+	if err := database.ValidateRange(from, to); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	filter, groupBy, ok := dimensionParams(c)
+	if !ok {
+		return
+	}
+
+	summary, err := ctrl.db.SummarizeRevenue(c.Request.Context(), from, to, filter, groupBy, c.Query("currency"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// ImportExchangeRates upserts exchange rates from a CSV body with date, base,
+// quote and rate columns. dry_run=true only validates. Nothing is written
+// unless every row is valid.
+func (ctrl *RevenueController) ImportExchangeRates(c *gin.Context) {
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		respondError(c, apperr.Invalid("dry_run", "invalid dry_run"))
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	rates, rowErrors, err := revenueio.ParseRates(body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(c, apperr.Errorf(apperr.ErrTooLarge, "import is larger than %d bytes", maxImportBytes))
+			return
+		}
+		badRequest(c, "", err)
+		return
+	}
+
+	report := gin.H{
+		"dry_run": dryRun,
+		"total":   len(rates) + len(rowErrors),
+		"valid":   len(rates),
+		"invalid": len(rowErrors),
+		"errors":  rowErrors,
+	}
+	if len(rowErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, report)
+		return
+	}
+	if dryRun {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	if err := ctrl.db.UpsertExchangeRates(c.Request.Context(), rates); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	log.Printf("imported %d exchange rates", len(rates))
+	report["imported"] = len(rates)
+	c.JSON(http.StatusOK, report)
+}
+
+// ListExchangeRates returns the stored exchange rates, optionally only those
+// of ?base= or ?quote=.
+func (ctrl *RevenueController) ListExchangeRates(c *gin.Context) {
+	rates, err := ctrl.db.ListExchangeRates(c.Request.Context(), c.Query("base"), c.Query("quote"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"exchange_rates": rates})
+}
+
+// requestFormat returns ?format= or, failing that, csv when the given media
+// type mentions it and json otherwise.
+func requestFormat(c *gin.Context, mediaType string) string {
+	if format := c.Query("format"); format != "" {
+		return format
+	}
+	if strings.Contains(mediaType, "csv") {
+		return revenueio.FormatCSV
+	}
+	return revenueio.FormatJSON
+}
+
+// dimensionParams reads the region, product_line and channel filters and
+// group_by, repeated or comma-separated, from the query, writing an error
+// response for unknown dimensions.
+func dimensionParams(c *gin.Context) (database.RevenueFilter, []string, bool) {
+	filter := database.RevenueFilter{
+		Region:      strings.TrimSpace(c.Query(database.DimRegion)),
+		ProductLine: strings.TrimSpace(c.Query(database.DimProductLine)),
+		Channel:     strings.TrimSpace(c.Query(database.DimChannel)),
+	}
+	groupBy, err := database.ParseGroupBy(c.QueryArray("group_by")...)
+	if err != nil {
+		respondError(c, err)
+		return filter, nil, false
+	}
+	return filter, groupBy, true
+}
+
+// revenueKeyParams reads the row key from the :year and :month path
+// parameters and the dimension query parameters.
+func revenueKeyParams(c *gin.Context) (database.RevenueKey, bool) {
+	month, year, ok := monthYearParams(c)
+	if !ok {
+		return database.RevenueKey{}, false
+	}
+	return database.RevenueKey{
+		Month:       month,
+		Year:        year,
+		Region:      strings.TrimSpace(c.Query(database.DimRegion)),
+		ProductLine: strings.TrimSpace(c.Query(database.DimProductLine)),
+		Channel:     strings.TrimSpace(c.Query(database.DimChannel)),
+	}, true
+}
+
+// monthYearParams parses the :year and :month path parameters, writing a 400
+// response when they are not numbers.
+func monthYearParams(c *gin.Context) (int, int, bool) {
+	year, err := strconv.Atoi(c.Param("year"))
+	if err != nil {
+		respondError(c, apperr.Invalid("year", "invalid year %q", c.Param("year")))
+		return 0, 0, false
+	}
+	month, err := strconv.Atoi(c.Param("month"))
+	if err != nil {
+		respondError(c, apperr.Invalid("month", "invalid month %q", c.Param("month")))
+		return 0, 0, false
+	}
+	return month, year, true
+}
@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tempfunctiontools/internal/apperr"
+	"tempfunctiontools/internal/database"
+	"tempfunctiontools/internal/resilience"
+	"tempfunctiontools/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ToolController exposes the agent's tool registry for inspection, runtime
+// enable/disable and direct invocation without an LLM.
+type ToolController struct {
+	agent *models.Agent
+}
+
+func NewToolController(agent *models.Agent) *ToolController {
+	return &ToolController{agent: agent}
+}
+
+// ListTools returns every registered tool with its schema and status.
+func (ctrl *ToolController) ListTools(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"tools": ctrl.agent.Tools.Statuses()})
+}
+
+// InvokeTool runs a tool with the JSON object in the request body as its
+// arguments. A failing tool answers with the status of its error kind, e.g.
+// 400 for bad arguments or 502 when a service it calls failed.
+func (ctrl *ToolController) InvokeTool(c *gin.Context) {
+	name := c.Param("name")
+	args := map[string]any{}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&args); err != nil {
+			badRequest(c, "", err)
+			return
+		}
+	}
+
+	log.Printf("invoking tool %s with %v", name, args)
+
+	call, err := models.NewToolCall("", name, args)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	// unknown tools are 404, disabled ones and those requiring approval 409
+	result, err := ctrl.agent.CallTool(withAuditIDs(c), call, false)
+	if err != nil {
+		log.Printf("tool %s failed: %v", name, err)
+		respondErrorWith(c, err, gin.H{"tool": name})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tool": name, "result": result})
+}
+
+// ListExamples returns the usage examples of the enabled tools as evaluation
+// cases: a query and the tool calls the model is expected to make.
+func (ctrl *ToolController) ListExamples(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"cases": models.EvalCases(ctrl.agent.ToolList())})
+}
+
+func (ctrl *ToolController) EnableTool(c *gin.Context) {
+	ctrl.setEnabled(c, true)
+}
+
+func (ctrl *ToolController) DisableTool(c *gin.Context) {
+	ctrl.setEnabled(c, false)
+}
+
+func (ctrl *ToolController) setEnabled(c *gin.Context, enabled bool) {
+	name := c.Param("name")
+	if err := ctrl.agent.Tools.SetEnabled(name, enabled); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	log.Printf("tool %s enabled: %t", name, enabled)
+	c.JSON(http.StatusOK, gin.H{"name": name, "enabled": enabled})
+}
+
+// ListBackends returns the rate limiter and circuit breaker state of every
+// external backend used by the tools.
+func (ctrl *ToolController) ListBackends(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"backends": resilience.Statuses()})
+}
+
+// defaultToolCallLimit caps ListToolCalls when no limit is given.
+const (
+	defaultToolCallLimit = 100
+	maxToolCallLimit     = 1000
+)
+
+// ListToolCalls returns audited tool calls, newest first, filtered by tool,
+// status, conversation_id, request_id and a from/to time range. limit is
+// between 1 and maxToolCallLimit.
+func (ctrl *ToolController) ListToolCalls(c *gin.Context) {
+	filter := database.ToolCallFilter{
+		ToolName:       c.Query("tool"),
+		Status:         c.Query("status"),
+		ConversationID: c.Query("conversation_id"),
+		RequestID:      c.Query("request_id"),
+		Limit:          defaultToolCallLimit,
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(c.Query("from"), false); err != nil {
+		respondError(c, apperr.Invalid("from", "invalid from: %v", err))
+		return
+	}
+	if filter.To, err = parseTimeParam(c.Query("to"), true); err != nil {
+		respondError(c, apperr.Invalid("to", "invalid to: %v", err))
+		return
+	}
+	if filter.Limit, err = parseIntParam(c.Query("limit"), defaultToolCallLimit); err != nil || filter.Limit == 0 {
+		respondError(c, apperr.Invalid("limit", "limit must be a number from 1 to %d", maxToolCallLimit))
+		return
+	}
+	filter.Limit = min(filter.Limit, maxToolCallLimit)
+	if filter.Offset, err = parseIntParam(c.Query("offset"), 0); err != nil {
+		respondError(c, apperr.Invalid("offset", "invalid offset: %v", err))
+		return
+	}
+
+	calls, err := ctrl.agent.Db.ListToolCalls(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tool_calls": calls})
+}
+
+// parseTimeParam accepts RFC3339 timestamps or plain dates. Empty means no
+// bound. For an exclusive upper bound, endOfDay makes a plain date include
+// its whole day by returning the start of the next one.
+func parseTimeParam(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err == nil && endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, err
+}
+
+func parseIntParam(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err == nil && n < 0 {
+		return 0, strconv.ErrRange
+	}
+	return n, err
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"log"
+	"strings"
+
+	"tempfunctiontools/internal/retrieval"
+	"tempfunctiontools/models"
+)
+
+// selectTools returns the tools sent with a request. With retrieval enabled
+// the enabled tools are ranked against the latest user message with BM25 and
+// only the pinned tools plus the top K are sent. If no tool matches the
+// message at all, every tool is sent as before, so the model is never left
+// without tools it might need.
+func (ctrl *ChatController) selectTools(messages []models.Message) []models.Tool {
+	tools := ctrl.agent.ToolList()
+
+	cfg := ctrl.config.Retrieval
+	if cfg.TopK <= 0 || len(tools) <= cfg.TopK+len(cfg.Pinned) {
+		return tools
+	}
+
+	query := latestUserMessage(messages)
+	if query == "" {
+		return tools
+	}
+
+	pinned := make(map[string]bool, len(cfg.Pinned))
+	for _, name := range cfg.Pinned {
+		pinned[name] = true
+	}
+
+	docs := make([]retrieval.Document, 0, len(tools))
+	for _, tool := range tools {
+		if !pinned[tool.Function.Name] {
+			docs = append(docs, retrieval.Document{ID: tool.Function.Name, Text: toolText(tool)})
+		}
+	}
+
+	ranked := retrieval.NewIndex(docs).Search(query, cfg.TopK)
+	if len(ranked) == 0 {
+		log.Printf("tool retrieval: no tool matches %q, sending all %d tools", query, len(tools))
+		return tools
+	}
+
+	selected := make(map[string]bool, len(ranked))
+	names := make([]string, 0, len(ranked))
+	for _, result := range ranked {
+		selected[result.ID] = true
+		names = append(names, result.ID)
+	}
+
+	filtered := make([]models.Tool, 0, len(ranked)+len(pinned))
+	for _, tool := range tools {
+		if pinned[tool.Function.Name] || selected[tool.Function.Name] {
+			filtered = append(filtered, tool)
+		}
+	}
+
+	log.Printf("tool retrieval: sending %d of %d tools, ranked: %s", len(filtered), len(tools), strings.Join(names, ", "))
+	return filtered
+}
+
+// toolText is the text a tool is indexed by: its name and description.
+func toolText(tool models.Tool) string {
+	return tool.Function.Name + " " + tool.Function.Description
+}
+
+func latestUserMessage(messages []models.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == models.ChatMessageRoleUser {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
@@ -0,0 +1,209 @@
+// Package apperr is the error taxonomy shared by the database, the tools and
+// the HTTP handlers. Errors wrap one of the kinds below, so callers check
+// them with errors.Is, HTTP handlers answer with Status and tool failures are
+// handed to the model with ToolMessage.
+package apperr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error kinds.
+var (
+	// ErrNotFound means the requested row, tool or run does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrInvalid means the input is malformed or out of range.
+	ErrInvalid = errors.New("invalid input")
+	// ErrUnauthorized means the request lacks valid credentials.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrConflict means the input clashes with stored data, e.g. a row that
+	// already exists.
+	ErrConflict = errors.New("conflict")
+	// ErrUnprocessable means the input is valid but the stored data cannot
+	// answer it, e.g. an exchange rate is missing.
+	ErrUnprocessable = errors.New("cannot be processed")
+	// ErrTooLarge means the input is over a size limit.
+	ErrTooLarge = errors.New("too large")
+	// ErrUpstream means an external service failed or answered with an
+	// error.
+	ErrUpstream = errors.New("upstream error")
+	// ErrUnavailable means an external service is rate limited or its
+	// circuit breaker is open. It is also an ErrUpstream.
+	ErrUnavailable = errors.New("temporarily unavailable")
+)
+
+// kindError is an error of a kind with its own message.
+type kindError struct {
+	kind    error
+	message string
+	err     error
+}
+
+func (e *kindError) Error() string {
+	return e.message
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+// New returns a sentinel error with its own message that is also of kind,
+// e.g. New(ErrNotFound, "revenue not found").
+func New(kind error, message string) error {
+	return &kindError{kind: kind, message: message}
+}
+
+// Errorf returns an error of kind with a formatted message. A %w verb wraps
+// its operand like in fmt.Errorf.
+func Errorf(kind error, format string, args ...any) error {
+	err := fmt.Errorf(format, args...)
+	return &kindError{kind: kind, message: err.Error(), err: errors.Unwrap(err)}
+}
+
+// ValidationError is an ErrInvalid about one input field.
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+// Invalid returns a ValidationError for field with a formatted message.
+func Invalid(field, format string, args ...any) error {
+	return &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// UpstreamError is an ErrUpstream from an external service.
+type UpstreamError struct {
+	Service string
+	// StatusCode is the HTTP status the service answered with, 0 if the
+	// call failed without an answer or was not made.
+	StatusCode int
+	// Unavailable is set when the call was not made because the service is
+	// rate limited or its circuit breaker is open.
+	Unavailable bool
+	Err         error
+}
+
+func (e *UpstreamError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+func (e *UpstreamError) Is(target error) bool {
+	return target == ErrUpstream || target == ErrUnavailable && e.Unavailable
+}
+
+// Upstream returns an UpstreamError for a failed call to service. status is
+// the HTTP status of its answer, or 0.
+func Upstream(service string, status int, err error) error {
+	return &UpstreamError{Service: service, StatusCode: status, Err: err}
+}
+
+// Unavailable returns an UpstreamError for a call to service that was not
+// made, with a formatted message.
+func Unavailable(service, format string, args ...any) error {
+	return &UpstreamError{Service: service, Unavailable: true, Err: fmt.Errorf(format, args...)}
+}
+
+// Status returns the HTTP status for an error: 404, 400, 401, 409, 422, 413,
+// 503, 502, 504 for a timeout and 500 for anything else.
+func Status(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrUnprocessable):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrUpstream):
+		return http.StatusBadGateway
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// Code returns a short name for the kind of an error, e.g. not_found, for
+// clients and the model.
+func Code(err error) string {
+	switch Status(err) {
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusBadRequest:
+		return "invalid_argument"
+	case http.StatusUnauthorized:
+		return "unauthenticated"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusUnprocessableEntity:
+		return "unprocessable"
+	case http.StatusRequestEntityTooLarge:
+		return "too_large"
+	case http.StatusServiceUnavailable:
+		return "unavailable"
+	case http.StatusBadGateway:
+		return "upstream_error"
+	case http.StatusGatewayTimeout:
+		return "timeout"
+	}
+	return "internal"
+}
+
+// Response returns the JSON body of an error response: the message, its
+// code and, for a validation error, the field.
+func Response(err error) map[string]any {
+	body := map[string]any{"error": err.Error(), "code": Code(err)}
+	var validation *ValidationError
+	if errors.As(err, &validation) && validation.Field != "" {
+		body["field"] = validation.Field
+	}
+	return body
+}
+
+// toolHints tell the model what to do about each kind of tool failure.
+var toolHints = map[string]string{
+	"not_found":        "Nothing matches these arguments. Do not retry them unchanged; tell the user if the data does not exist.",
+	"invalid_argument": "Fix the arguments and call the tool again.",
+	"conflict":         "The call conflicts with the current state. Do not retry it unchanged.",
+	"unprocessable":    "The arguments are valid but the data cannot answer them; the message says what is missing.",
+	"too_large":        "The input is over a size limit. Split it into smaller calls.",
+	"unavailable":      "The service is temporarily unavailable. Try again later or answer without it.",
+	"upstream_error":   "An external service failed. Retrying may help, otherwise tell the user.",
+	"timeout":          "The call took too long. Narrow it down and try again.",
+}
+
+// ToolMessage describes a tool failure to the model: the kind, the message
+// and what to do about it.
+func ToolMessage(err error) string {
+	code := Code(err)
+	message := fmt.Sprintf("Error (%s): %s", code, err)
+	if hint, ok := toolHints[code]; ok {
+		message += "\n" + hint
+	}
+	return message
+}
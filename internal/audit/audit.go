@@ -0,0 +1,177 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"tempfunctiontools/internal/config"
+	"tempfunctiontools/internal/database"
+)
+
+const redacted = "[REDACTED]"
+
+// keys redacted when the config does not list any
+var defaultRedactKeys = []string{"password", "secret", "token", "api_key", "apikey", "authorization"}
+
+// bearerCredential matches the credential of an Authorization header value.
+var bearerCredential = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[^\s"',;]+`)
+
+type contextKey struct{}
+
+type ids struct {
+	conversationID string
+	requestID      string
+}
+
+// WithIDs attaches the conversation and request IDs recorded with every
+// tool call made while handling the request.
+func WithIDs(ctx context.Context, conversationID, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, ids{conversationID: conversationID, requestID: requestID})
+}
+
+// IDs returns the conversation and request IDs attached to ctx.
+func IDs(ctx context.Context) (string, string) {
+	v, _ := ctx.Value(contextKey{}).(ids)
+	return v.conversationID, v.requestID
+}
+
+// Logger writes tool calls to the tool_calls table.
+type Logger struct {
+	db         *database.DbConfig
+	disabled   bool
+	redactKeys []string
+	// textPairs matches key=value and key: value pairs of sensitive keys
+	// in text that is not JSON, e.g. error messages.
+	textPairs *regexp.Regexp
+}
+
+func NewLogger(db *database.DbConfig, cfg config.Audit) *Logger {
+	keys := cfg.RedactKeys
+	if len(keys) == 0 {
+		keys = defaultRedactKeys
+	}
+	for i, key := range keys {
+		keys[i] = strings.ToLower(key)
+	}
+
+	quoted := make([]string, len(keys))
+	for i, key := range keys {
+		quoted[i] = regexp.QuoteMeta(key)
+	}
+
+	return &Logger{
+		db:         db,
+		disabled:   cfg.Disabled,
+		redactKeys: keys,
+		textPairs:  regexp.MustCompile(`(?i)([\w-]*(?:` + strings.Join(quoted, "|") + `)[\w-]*["']?\s*[:=]\s*["']?(?:(?:bearer|basic)\s+)?)[^\s"'&,;]+`),
+	}
+}
+
+// Entry describes one tool call to record.
+type Entry struct {
+	ToolCallID string
+	ToolName   string
+	// CalledAs is the alias the model used, if any.
+	CalledAs  string
+	Arguments string
+	Result    string
+	Err       error
+	Status    string
+	Started   time.Time
+}
+
+// Record stores the entry. Failures are logged and never fail the call.
+func (l *Logger) Record(ctx context.Context, entry Entry) {
+	if l == nil || l.disabled || l.db == nil {
+		return
+	}
+
+	conversationID, requestID := IDs(ctx)
+
+	call := &database.ToolCall{
+		ConversationID: conversationID,
+		RequestID:      requestID,
+		ToolCallID:     entry.ToolCallID,
+		ToolName:       entry.ToolName,
+		CalledAs:       entry.CalledAs,
+		Arguments:      l.Redact(entry.Arguments),
+		Result:         l.Redact(entry.Result),
+		Status:         entry.Status,
+		DurationMs:     time.Since(entry.Started).Milliseconds(),
+		CreatedAt:      entry.Started,
+	}
+	if entry.Err != nil {
+		call.Error = l.RedactText(entry.Err.Error())
+		if call.Status == "" {
+			call.Status = database.ToolCallError
+		}
+	}
+	if call.Status == "" {
+		call.Status = database.ToolCallSuccess
+	}
+
+	// the request may already be finished, do not let its cancellation drop
+	// the record
+	if err := l.db.InsertToolCall(context.WithoutCancel(ctx), call); err != nil {
+		log.Printf("audit: %v", err)
+	}
+}
+
+// Redact replaces the values of sensitive keys in a JSON document. Text that
+// is not JSON goes through RedactText.
+func (l *Logger) Redact(text string) string {
+	if text == "" {
+		return text
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return l.RedactText(text)
+	}
+
+	data, err := json.Marshal(l.redactValue(value))
+	if err != nil {
+		return text
+	}
+	return string(data)
+}
+
+// RedactText replaces bearer and basic credentials and the values of
+// sensitive keys written as key=value or key: value in free text such as
+// error messages.
+func (l *Logger) RedactText(text string) string {
+	text = bearerCredential.ReplaceAllString(text, "${1} "+redacted)
+	return l.textPairs.ReplaceAllString(text, "${1}"+redacted)
+}
+
+func (l *Logger) redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if l.sensitive(key) {
+				v[key] = redacted
+			} else {
+				v[key] = l.redactValue(item)
+			}
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = l.redactValue(item)
+		}
+	}
+	return value
+}
+
+func (l *Logger) sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range l.redactKeys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"tempfunctiontools/internal/config"
+	"tempfunctiontools/internal/database"
+	"tempfunctiontools/models"
+)
+
+// Backend stores encoded tool results.
+type Backend interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	Set(ctx context.Context, tool, key string, value []byte, ttl time.Duration)
+	// Invalidate drops every entry of a tool.
+	Invalidate(ctx context.Context, tool string)
+}
+
+// NewBackend returns the backend named in the config. The database backend,
+// also named sqlite, stores entries in the application database so they
+// survive restarts.
+func NewBackend(cfg config.Cache, db *database.DbConfig) Backend {
+	if (cfg.Backend == "database" || cfg.Backend == "sqlite") && db != nil {
+		backend, err := NewSQLiteBackend(db)
+		if err == nil {
+			return backend
+		}
+		log.Printf("cache: falling back to memory backend: %v", err)
+	}
+	return NewMemoryBackend()
+}
+
+// Key builds the cache key from the tool name and the normalized arguments.
+// Arguments are re-encoded so that key order and number formatting do not
+// matter.
+func Key(tool string, args map[string]any) string {
+	normalized := map[string]any{}
+	for k, v := range args {
+		if v != nil {
+			normalized[k] = v
+		}
+	}
+
+	// encoding a map sorts its keys
+	data, _ := json.Marshal(normalized)
+	sum := sha256.Sum256(append([]byte(tool+"\x00"), data...))
+	return tool + ":" + hex.EncodeToString(sum[:])
+}
+
+// Apply wraps the Execute function of every configured tool with the cache
+// and wires invalidation to database changes.
+func Apply(registry *models.ToolRegistry, cfg config.Cache, backend Backend, db *database.DbConfig) {
+	for name, toolCfg := range cfg.Tools {
+		if toolCfg.TTL <= 0 {
+			continue
+		}
+
+		name, ttl := name, toolCfg.TTL
+		err := registry.Wrap(name, func(tool models.Tool) models.Tool {
+			tool.Execute = cached(name, tool.Version, ttl, backend, tool.Execute)
+			return tool
+		})
+		if err != nil {
+			log.Printf("cache: %v", err)
+			continue
+		}
+		log.Printf("cache: caching %s for %s", name, ttl)
+	}
+
+	if db == nil {
+		return
+	}
+	db.OnChange(func(table string) {
+		for name, toolCfg := range cfg.Tools {
+			if slices.Contains(toolCfg.InvalidateOn, table) {
+				log.Printf("cache: %s changed, invalidating %s", table, name)
+				backend.Invalidate(context.Background(), name)
+			}
+		}
+	})
+}
+
+// cached wraps execute with the cache. Versions of a tool get their own keys
+// but share the tool's entries for invalidation.
+func cached(tool string, version int, ttl time.Duration, backend Backend, execute func(context.Context, map[string]any) (any, error)) func(context.Context, map[string]any) (any, error) {
+	keyName := tool
+	if version != 0 {
+		keyName = fmt.Sprintf("%s@%d", tool, version)
+	}
+	return func(ctx context.Context, args map[string]any) (any, error) {
+		key := Key(keyName, args)
+
+		if data, ok := backend.Get(ctx, key); ok {
+			var result any
+			if err := json.Unmarshal(data, &result); err == nil {
+				log.Printf("cache: hit for %s", tool)
+				return result, nil
+			}
+		}
+
+		result, err := execute(ctx, args)
+		if err != nil {
+			// errors are not cached
+			return nil, err
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			log.Printf("cache: cannot encode result of %s: %v", tool, err)
+			return result, nil
+		}
+		backend.Set(ctx, tool, key, data, ttl)
+
+		return result, nil
+	}
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	tool      string
+	value     []byte
+	expiresAt time.Time
+}
+
+// MemoryBackend keeps entries in process memory.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{entries: make(map[string]memoryEntry)}
+}
+
+func (b *MemoryBackend) Get(ctx context.Context, key string) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry, ok := b.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(b.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (b *MemoryBackend) Set(ctx context.Context, tool, key string, value []byte, ttl time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for k, entry := range b.entries {
+		if now.After(entry.expiresAt) {
+			delete(b.entries, k)
+		}
+	}
+
+	b.entries[key] = memoryEntry{tool: tool, value: value, expiresAt: now.Add(ttl)}
+}
+
+func (b *MemoryBackend) Invalidate(ctx context.Context, tool string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for k, entry := range b.entries {
+		if entry.tool == tool {
+			delete(b.entries, k)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"tempfunctiontools/internal/database"
+)
+
+// SQLiteBackend stores entries in the tool_cache table of the application
+// database, created by its migrations, whatever its dialect.
+type SQLiteBackend struct {
+	db *database.DbConfig
+}
+
+func NewSQLiteBackend(db *database.DbConfig) (*SQLiteBackend, error) {
+	return &SQLiteBackend{db: db}, nil
+}
+
+func (b *SQLiteBackend) Get(ctx context.Context, key string) ([]byte, bool) {
+	entry, err := b.db.GetCacheEntry(ctx, key)
+	if err != nil {
+		log.Printf("cache: %v", err)
+		return nil, false
+	}
+	if entry == nil {
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+func (b *SQLiteBackend) Set(ctx context.Context, tool, key string, value []byte, ttl time.Duration) {
+	entry := &database.CacheEntry{
+		Key:       key,
+		Tool:      tool,
+		Value:     value,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := b.db.SetCacheEntry(ctx, entry); err != nil {
+		log.Printf("cache: %v", err)
+	}
+}
+
+func (b *SQLiteBackend) Invalidate(ctx context.Context, tool string) {
+	if err := b.db.DeleteCacheEntries(ctx, tool); err != nil {
+		log.Printf("cache: %v", err)
+	}
+}
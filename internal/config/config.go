@@ -0,0 +1,376 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultConfigFile = "config.yaml"
+	configFileEnv     = "CONFIG_FILE"
+)
+
+// Config holds the optional service configuration. JSON files are accepted as
+// well since YAML is a superset of JSON.
+type Config struct {
+	MCPServers []MCPServer `yaml:"mcp_servers"`
+	// MCP configures the MCP streamable HTTP endpoint this service serves.
+	MCP     MCPHTTP       `yaml:"mcp"`
+	OpenAPI []OpenAPISpec `yaml:"openapi"`
+	Tools   []ToolSpec    `yaml:"tools"`
+	Aliases []Alias       `yaml:"aliases"`
+	// RequireApproval lists tools, from any source, whose calls must be
+	// approved by a reviewer before they run.
+	RequireApproval []string `yaml:"require_approval"`
+	Results         Results  `yaml:"results"`
+	Cache           Cache    `yaml:"cache"`
+	// Backends sets rate limits and circuit breakers for external services,
+	// keyed by name (wttr.in, ip-api.com).
+	Backends map[string]Backend `yaml:"backends"`
+	Audit    Audit              `yaml:"audit"`
+	// Admin guards the endpoints that run or toggle tools and read the
+	// audit log and backend state.
+	Admin Admin `yaml:"admin"`
+	// Retrieval sends only the tools most relevant to the latest user
+	// message instead of every registered tool.
+	Retrieval Retrieval `yaml:"retrieval"`
+	Examples  Examples  `yaml:"examples"`
+	Database  Database  `yaml:"database"`
+	// QueryDatabase configures the query_database tool, which runs the
+	// model's own SELECT statements.
+	QueryDatabase QueryDatabase `yaml:"query_database"`
+}
+
+// QueryDatabase limits what the query_database tool can read.
+type QueryDatabase struct {
+	Disabled bool `yaml:"disabled"`
+	// Tables that queries may read. Their schema is given to the model.
+	Tables []string `yaml:"tables"`
+	// MaxRows caps the rows returned; the result says when it was cut.
+	MaxRows int `yaml:"max_rows"`
+	// Timeout cancels queries running longer.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Database configures the revenue database.
+type Database struct {
+	// Dialect is sqlite (default), postgres or mysql.
+	Dialect string `yaml:"dialect"`
+	// DSN is the SQLite file, revenue.db by default, or the Postgres or
+	// MySQL data source name. Environment variables in it are expanded.
+	DSN string `yaml:"dsn"`
+	// Connection pool limits. Zero keeps the database/sql default.
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+	// AutoMigrate applies pending schema migrations at startup. When off,
+	// startup fails until `migrate up` has been run.
+	AutoMigrate bool `yaml:"auto_migrate"`
+	// SeedFile is a CSV or JSON file of revenues loaded at startup. Only
+	// months without revenue are inserted. Empty means no seeding.
+	SeedFile string `yaml:"seed_file"`
+	// ExchangeRatesFile is a CSV of date, base, quote and rate columns
+	// upserted into the exchange rates table at startup.
+	ExchangeRatesFile string `yaml:"exchange_rates_file"`
+}
+
+// Examples sets where tool usage examples are rendered.
+type Examples struct {
+	// Placement is description (the default), system or none.
+	Placement string `yaml:"placement"`
+	// Providers overrides Placement per provider, the part of the model
+	// name before the slash, e.g. anthropic for anthropic/claude-3.5-sonnet.
+	Providers map[string]string `yaml:"providers"`
+}
+
+// PlacementFor returns the example placement for a model.
+func (e Examples) PlacementFor(model string) string {
+	if provider, _, ok := strings.Cut(model, "/"); ok {
+		if placement, ok := e.Providers[provider]; ok {
+			return placement
+		}
+	}
+	if e.Placement == "" {
+		return "description"
+	}
+	return e.Placement
+}
+
+// Retrieval configures BM25 ranking of tools against the latest user
+// message.
+type Retrieval struct {
+	// TopK is the number of ranked tools sent. Zero sends every tool.
+	TopK int `yaml:"top_k"`
+	// Pinned tools are always sent and do not count towards TopK.
+	Pinned []string `yaml:"pinned"`
+}
+
+// MCPServer describes an external MCP server whose tools are imported into the
+// agent. Either Command (stdio transport) or URL (streamable HTTP) is set.
+type MCPServer struct {
+	Name    string            `yaml:"name"`
+	Command string            `yaml:"command"`
+	Args    []string          `yaml:"args"`
+	Env     map[string]string `yaml:"env"`
+	Dir     string            `yaml:"dir"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	// Prefix is prepended to every imported tool name to avoid collisions.
+	Prefix string `yaml:"prefix"`
+}
+
+// OpenAPISpec points at an OpenAPI 3 document whose operations are imported
+// as HTTP tools.
+type OpenAPISpec struct {
+	Spec string `yaml:"spec"`
+	// BaseURL overrides the first server URL of the document.
+	BaseURL string `yaml:"base_url"`
+	// Headers are sent with every request, e.g. auth headers. Values are
+	// expanded with environment variables, so secrets can stay out of the file.
+	Headers map[string]string `yaml:"headers"`
+	// Operations is an allow-list of operation IDs. Empty imports all.
+	Operations []string `yaml:"operations"`
+	Prefix     string   `yaml:"prefix"`
+}
+
+// ToolSpec declares a tool without Go code. Exactly one of HTTP, SQL or Exec
+// is set.
+type ToolSpec struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// Parameters is the JSON Schema of the tool arguments.
+	Parameters map[string]any `yaml:"parameters"`
+	HTTP       *HTTPToolSpec  `yaml:"http"`
+	SQL        *SQLToolSpec   `yaml:"sql"`
+	Exec       *ExecToolSpec  `yaml:"exec"`
+	// Composite runs other registered tools as a single tool.
+	Composite *CompositeToolSpec `yaml:"composite"`
+
+	RequiresApproval bool `yaml:"requires_approval"`
+	// Examples are sample queries with the calls that answer them.
+	Examples []ToolExample `yaml:"examples"`
+	// Version allows several definitions under one name; the highest is
+	// current and older ones stay reachable through pinned aliases.
+	Version int `yaml:"version"`
+}
+
+// CompositeToolSpec declares a pipeline of tool calls. Steps run as soon as
+// the steps they depend on have finished, so independent steps run in
+// parallel.
+type CompositeToolSpec struct {
+	Steps []CompositeStep `yaml:"steps"`
+	// Result shapes the tool result from the step outputs, like step
+	// arguments do. Empty returns every step's output keyed by step id.
+	Result any `yaml:"result"`
+}
+
+// CompositeStep calls one tool. In Args, a string that is a JSON path such
+// as $.input.format or $.<step id>.location.city takes that value, and
+// {$...} placeholders inside other strings are replaced by it.
+type CompositeStep struct {
+	ID   string         `yaml:"id"`
+	Tool string         `yaml:"tool"`
+	Args map[string]any `yaml:"args"`
+	// After lists steps to wait for besides the ones referenced in Args.
+	After []string `yaml:"after"`
+}
+
+// ToolExample is a sample query with the tool calls that answer it. A call
+// without a name calls the tool the example belongs to.
+type ToolExample struct {
+	Query string `yaml:"query"`
+	Calls []struct {
+		Name      string         `yaml:"name"`
+		Arguments map[string]any `yaml:"arguments"`
+	} `yaml:"calls"`
+	Note string `yaml:"note"`
+}
+
+// Alias maps an old tool name to a current tool, reshaping the arguments on
+// the way.
+type Alias struct {
+	Name   string `yaml:"name"`
+	Target string `yaml:"target"`
+	// Version pins the alias to one version of the target, zero means current.
+	Version int `yaml:"version"`
+	// Rename maps old argument names to the target's.
+	Rename map[string]string `yaml:"rename"`
+	// Defaults fills arguments the old callers do not send.
+	Defaults   map[string]any `yaml:"defaults"`
+	Deprecated bool           `yaml:"deprecated"`
+	Note       string         `yaml:"note"`
+}
+
+// HTTPToolSpec calls a URL. {name} placeholders in URL, Headers and Body are
+// replaced with the tool arguments; a missing argument fails the call.
+// ${NAME} in Headers is replaced with the environment variable.
+type HTTPToolSpec struct {
+	Method  string            `yaml:"method"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+	// ResultPath is a JSONPath such as $.current_condition[0].temp_C that
+	// selects the part of the JSON response returned to the model.
+	ResultPath string `yaml:"result_path"`
+}
+
+// SQLToolSpec runs a read-only query against the application database. Args
+// lists the tool arguments bound to the ? placeholders, in order.
+type SQLToolSpec struct {
+	Query   string   `yaml:"query"`
+	Args    []string `yaml:"args"`
+	MaxRows int      `yaml:"max_rows"`
+}
+
+// ExecToolSpec runs an executable that reads the JSON arguments on stdin and
+// writes a JSON result to stdout. A non-zero exit status fails the call with
+// stderr as the message.
+type ExecToolSpec struct {
+	Command string        `yaml:"command"`
+	Args    []string      `yaml:"args"`
+	Dir     string        `yaml:"dir"`
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxOutputBytes caps stdout; larger output fails the call.
+	MaxOutputBytes int `yaml:"max_output_bytes"`
+	// Env lists the environment variables passed through to the process.
+	// Nothing else from the service environment is visible to it.
+	Env []string `yaml:"env"`
+}
+
+// Results limits the size of tool results sent back to the model.
+type Results struct {
+	Default ResultLimit            `yaml:"default"`
+	Tools   map[string]ResultLimit `yaml:"tools"`
+	// SummaryModel is used to summarize oversized results of tools with
+	// Summarize set. Without it results are truncated instead.
+	SummaryModel string `yaml:"summary_model"`
+}
+
+type ResultLimit struct {
+	MaxBytes  int  `yaml:"max_bytes"`
+	MaxTokens int  `yaml:"max_tokens"`
+	Summarize bool `yaml:"summarize"`
+}
+
+// Limit returns the limit of a tool, falling back to the default.
+func (r Results) Limit(tool string) ResultLimit {
+	if limit, ok := r.Tools[tool]; ok {
+		return limit
+	}
+	return r.Default
+}
+
+// Cache configures caching of tool results.
+type Cache struct {
+	// Backend is "memory" (default) or "database", which stores entries in
+	// the application database. "sqlite" is an older name for "database".
+	Backend string               `yaml:"backend"`
+	Tools   map[string]ToolCache `yaml:"tools"`
+	// LocationTTL is how long the server's ip-api.com location is reused by
+	// the date and time tool, which still reads the clock on every call. A
+	// negative value looks the location up every time.
+	LocationTTL time.Duration `yaml:"location_ttl"`
+}
+
+type ToolCache struct {
+	TTL time.Duration `yaml:"ttl"`
+	// InvalidateOn lists database tables whose changes drop the tool's
+	// cached results.
+	InvalidateOn []string `yaml:"invalidate_on"`
+}
+
+type Backend struct {
+	// Rate is the sustained number of calls per second, Burst the bucket size.
+	// Fields left out keep the backend's defaults; a negative rate disables
+	// the limit.
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+	// FailureThreshold consecutive failures open the breaker for OpenTimeout.
+	FailureThreshold int           `yaml:"failure_threshold"`
+	OpenTimeout      time.Duration `yaml:"open_timeout"`
+	// Timeout bounds each call, reading the response included. A call that
+	// runs longer is cancelled and counts as a failure.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// MCPHTTP configures access to the /mcp endpoint.
+type MCPHTTP struct {
+	// Token must be sent as "Authorization: Bearer <token>". ${NAME} is
+	// replaced with the environment variable. Empty disables the endpoint.
+	Token string `yaml:"token"`
+	// AllowedOrigins are the browser origins, e.g. https://app.example.com,
+	// allowed to call the endpoint. Requests without an Origin header are
+	// not from a browser and are let through.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// Admin configures access to the admin endpoints.
+type Admin struct {
+	// Token must be sent as "Authorization: Bearer <token>". ${NAME} is
+	// replaced with the environment variable. Empty disables the endpoints.
+	Token string `yaml:"token"`
+}
+
+// Audit configures the tool call audit log.
+type Audit struct {
+	Disabled bool `yaml:"disabled"`
+	// RedactKeys are JSON keys, matched case-insensitively as substrings,
+	// whose values are replaced before arguments and results are stored.
+	RedactKeys []string `yaml:"redact_keys"`
+}
+
+// Load reads the config file named by CONFIG_FILE, or config.yaml by default.
+// A missing file is not an error and yields an empty config.
+func Load() (*Config, error) {
+	path := os.Getenv(configFileEnv)
+	if path == "" {
+		path = defaultConfigFile
+	}
+	return LoadFile(path)
+}
+
+func LoadFile(path string) (*Config, error) {
+	cfg := &Config{
+		Results: Results{
+			Default: ResultLimit{MaxBytes: 16 * 1024, MaxTokens: 4000},
+		},
+		Cache: Cache{
+			Backend:     "memory",
+			LocationTTL: 10 * time.Minute,
+			Tools: map[string]ToolCache{
+				"get_location_current_and_forecast_weather": {TTL: 10 * time.Minute},
+				"get_revenue_by_month_and_year":             {TTL: time.Hour, InvalidateOn: []string{"revenue", "exchange_rates"}},
+				"get_revenue_summary":                       {TTL: time.Hour, InvalidateOn: []string{"revenue", "exchange_rates"}},
+				"get_quarterly_revenue":                     {TTL: time.Hour, InvalidateOn: []string{"revenue", "exchange_rates"}},
+			},
+		},
+		Database: Database{AutoMigrate: true},
+		QueryDatabase: QueryDatabase{
+			Tables:  []string{"revenue", "exchange_rates"},
+			MaxRows: 200,
+			Timeout: 5 * time.Second,
+		},
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("config file %s not found, using defaults", path)
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,422 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"tempfunctiontools/internal/apperr"
+)
+
+// maxSummaryMonths bounds the range of one revenue summary.
+const maxSummaryMonths = 240
+
+// YearMonth is a calendar month, written as YYYY-MM.
+type YearMonth struct {
+	Year  int
+	Month int
+}
+
+// ParseYearMonth parses a YYYY-MM string.
+func ParseYearMonth(s string) (YearMonth, error) {
+	t, err := time.Parse("2006-01", s)
+	if err != nil {
+		return YearMonth{}, apperr.Invalid("", "invalid month %q, use YYYY-MM", s)
+	}
+	return YearMonth{Year: t.Year(), Month: int(t.Month())}, nil
+}
+
+func (ym YearMonth) String() string {
+	return fmt.Sprintf("%04d-%02d", ym.Year, ym.Month)
+}
+
+// index numbers months consecutively so ranges can be compared in SQL.
+func (ym YearMonth) index() int {
+	return ym.Year*12 + ym.Month - 1
+}
+
+// AddMonths returns the month n months later, or earlier for negative n.
+func (ym YearMonth) AddMonths(n int) YearMonth {
+	i := ym.index() + n
+	return YearMonth{Year: i / 12, Month: i%12 + 1}
+}
+
+// lastDay returns the last day of the month as YYYY-MM-DD.
+func (ym YearMonth) lastDay() string {
+	return time.Date(ym.Year, time.Month(ym.Month)+1, 0, 0, 0, 0, 0, time.UTC).Format(time.DateOnly)
+}
+
+// MonthRevenue is one month of a summary. Growth is in percent and nil when
+// the month it compares against has no data or no revenue.
+type MonthRevenue struct {
+	Month     string   `json:"month"`
+	Amount    float64  `json:"amount"`
+	MoMGrowth *float64 `json:"mom_growth_pct"`
+	YoYGrowth *float64 `json:"yoy_growth_pct"`
+	PrevMonth *float64 `json:"previous_month,omitempty"`
+	PrevYear  *float64 `json:"previous_year,omitempty"`
+}
+
+// RevenueSummary aggregates the revenue of a range of months. Months without
+// data are listed in MissingMonths and are not counted as zero.
+type RevenueSummary struct {
+	From          string         `json:"from"`
+	To            string         `json:"to"`
+	Count         int            `json:"count"`
+	Sum           float64        `json:"sum"`
+	Average       *float64       `json:"average"`
+	Min           *float64       `json:"min"`
+	Max           *float64       `json:"max"`
+	Months        []MonthRevenue `json:"months"`
+	MissingMonths []string       `json:"missing_months"`
+	// YoYGrowth compares Sum with the same months a year earlier. It is nil
+	// unless both periods are complete.
+	YoYGrowth         *float64 `json:"yoy_growth_pct"`
+	PreviousPeriodSum *float64 `json:"previous_period_sum,omitempty"`
+	// Currency is the currency of every amount and RatesUsed the exchange
+	// rates applied to reach it.
+	Currency  string     `json:"currency"`
+	RatesUsed []RateUsed `json:"rates_used,omitempty"`
+	// Filter and Groups echo the dimension filter and the per-group totals
+	// when grouping was asked for.
+	Filter RevenueFilter  `json:"filter"`
+	Groups []RevenueGroup `json:"groups,omitempty"`
+}
+
+// SummarizeRevenue aggregates the revenue from one month to another,
+// inclusive, and reports month-over-month and year-over-year growth. Rows
+// are filtered by dimension first and the statistics are over monthly
+// totals, so segmented months count once. groupBy adds per-group totals.
+// Amounts are converted to currency, which may be left empty when all rows
+// of the range share one; the year before is then converted to it.
+func (c *DbConfig) SummarizeRevenue(ctx context.Context, from, to YearMonth, filter RevenueFilter, groupBy []string, currency string) (*RevenueSummary, error) {
+	if err := ValidateRange(from, to); err != nil {
+		return nil, err
+	}
+
+	// read a year before the range too, for growth of the first months
+	rows, err := c.revenueTotals(ctx, from.AddMonths(-12), to, filter, groupBy)
+	if err != nil {
+		return nil, err
+	}
+	if currency == "" {
+		if currency, err = c.rangeCurrency(ctx, rows, from); err != nil {
+			return nil, err
+		}
+	}
+	currency, rates, err := c.convertTotals(ctx, rows, currency)
+	if err != nil {
+		return nil, err
+	}
+	totals := &convertedTotals{totals: rows, currency: currency, rates: rates}
+	amounts := totals.monthAmounts()
+
+	summary := &RevenueSummary{
+		From:          from.String(),
+		To:            to.String(),
+		Months:        []MonthRevenue{},
+		MissingMonths: []string{},
+		Currency:      totals.currency,
+		RatesUsed:     totals.rates,
+		Filter:        filter,
+		Groups:        totals.groups(groupBy, from, to),
+	}
+
+	previousPeriod, previousComplete := 0.0, true
+	for ym := from; ym.index() <= to.index(); ym = ym.AddMonths(1) {
+		if previous, ok := amounts[ym.AddMonths(-12)]; ok {
+			previousPeriod += previous
+		} else {
+			previousComplete = false
+		}
+
+		amount, ok := amounts[ym]
+		if !ok {
+			summary.MissingMonths = append(summary.MissingMonths, ym.String())
+			continue
+		}
+
+		summary.Count++
+		summary.Sum += amount
+		if summary.Min == nil || amount < *summary.Min {
+			summary.Min = &amount
+		}
+		if summary.Max == nil || amount > *summary.Max {
+			summary.Max = &amount
+		}
+
+		month := MonthRevenue{Month: ym.String(), Amount: amount}
+		if previous, ok := amounts[ym.AddMonths(-1)]; ok {
+			month.PrevMonth = &previous
+			month.MoMGrowth = growth(amount, previous)
+		}
+		if previous, ok := amounts[ym.AddMonths(-12)]; ok {
+			month.PrevYear = &previous
+			month.YoYGrowth = growth(amount, previous)
+		}
+		summary.Months = append(summary.Months, month)
+	}
+
+	if summary.Count > 0 {
+		average := summary.Sum / float64(summary.Count)
+		summary.Average = &average
+	}
+	if previousComplete && len(summary.MissingMonths) == 0 {
+		summary.PreviousPeriodSum = &previousPeriod
+		summary.YoYGrowth = growth(summary.Sum, previousPeriod)
+	}
+
+	return summary, nil
+}
+
+// revenueTotal is the revenue of one month in one currency for one
+// combination of the grouped dimensions.
+type revenueTotal struct {
+	Year        int     `bun:"year"`
+	Month       int     `bun:"month"`
+	Currency    string  `bun:"currency"`
+	Region      string  `bun:"region"`
+	ProductLine string  `bun:"product_line"`
+	Channel     string  `bun:"channel"`
+	Amount      float64 `bun:"amount"`
+	Rows        int     `bun:"row_count"`
+}
+
+func (t revenueTotal) yearMonth() YearMonth {
+	return YearMonth{Year: t.Year, Month: t.Month}
+}
+
+// revenueTotals sums the rows matching the filter from one month to another
+// per month, currency and groupBy dimension with one grouped query.
+func (c *DbConfig) revenueTotals(ctx context.Context, from, to YearMonth, filter RevenueFilter, groupBy []string) ([]revenueTotal, error) {
+	for _, dim := range groupBy {
+		if !isDimension(dim) {
+			return nil, apperr.Invalid("group_by", "cannot group by %q", dim)
+		}
+	}
+	columns := append([]string{"year", "month", "currency"}, groupBy...)
+
+	var totals []revenueTotal
+	query := c.db.NewSelect().
+		Model((*Revenue)(nil)).
+		Column(columns...).
+		ColumnExpr("SUM(amount) AS amount").
+		ColumnExpr("COUNT(*) AS row_count").
+		Where("year * 12 + month - 1 BETWEEN ? AND ?", from.index(), to.index()).
+		Group(columns...)
+	if err := filter.apply(query).Scan(ctx, &totals); err != nil {
+		return nil, fmt.Errorf("failed to read revenue: %w", err)
+	}
+	return totals, nil
+}
+
+// rangeCurrency returns the currency the totals from a month on share, so
+// the months before, read for comparison only, do not decide it and are
+// converted instead. It is empty when no totals are that recent.
+func (c *DbConfig) rangeCurrency(ctx context.Context, totals []revenueTotal, from YearMonth) (string, error) {
+	var inRange []revenueTotal
+	for _, total := range totals {
+		if total.yearMonth().index() >= from.index() {
+			inRange = append(inRange, total)
+		}
+	}
+	if len(inRange) == 0 {
+		return "", nil
+	}
+	currency, _, err := c.convertTotals(ctx, inRange, "")
+	return currency, err
+}
+
+// convertedTotals are revenue totals in a single currency.
+type convertedTotals struct {
+	totals   []revenueTotal
+	currency string
+	rates    []RateUsed
+}
+
+// convertedTotals reads the totals of a range and converts them to
+// currency, see convertTotals.
+func (c *DbConfig) convertedTotals(ctx context.Context, from, to YearMonth, filter RevenueFilter, groupBy []string, currency string) (*convertedTotals, error) {
+	totals, err := c.revenueTotals(ctx, from, to, filter, groupBy)
+	if err != nil {
+		return nil, err
+	}
+	currency, rates, err := c.convertTotals(ctx, totals, currency)
+	if err != nil {
+		return nil, err
+	}
+	return &convertedTotals{totals: totals, currency: currency, rates: rates}, nil
+}
+
+// monthAmounts returns the total amount of each month that has rows.
+func (t *convertedTotals) monthAmounts() map[YearMonth]float64 {
+	amounts := map[YearMonth]float64{}
+	for _, total := range t.totals {
+		amounts[total.yearMonth()] += total.Amount
+	}
+	return amounts
+}
+
+// groups sums the totals from one month to another per combination of the
+// groupBy dimensions. It returns nil without grouping.
+func (t *convertedTotals) groups(groupBy []string, from, to YearMonth) []RevenueGroup {
+	if len(groupBy) == 0 {
+		return nil
+	}
+
+	index := map[RevenueGroup]int{}
+	groups := []RevenueGroup{}
+	for _, total := range t.totals {
+		if i := total.yearMonth().index(); i < from.index() || i > to.index() {
+			continue
+		}
+		key := RevenueGroup{Region: total.Region, ProductLine: total.ProductLine, Channel: total.Channel}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, key)
+		}
+		groups[i].Revenue += total.Amount
+		groups[i].Rows += total.Rows
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		for _, dim := range groupBy {
+			if a, b := groups[i].dimension(dim), groups[j].dimension(dim); a != b {
+				return a < b
+			}
+		}
+		return false
+	})
+	return groups
+}
+
+// ValidateRange checks that a range runs forwards and is not too long.
+func ValidateRange(from, to YearMonth) error {
+	if from.index() > to.index() {
+		return apperr.Invalid("start", "start %s is after end %s", from, to)
+	}
+	if months := to.index() - from.index() + 1; months > maxSummaryMonths {
+		return apperr.Invalid("end", "range of %d months is longer than %d", months, maxSummaryMonths)
+	}
+	return nil
+}
+
+// growth returns the change from previous to current in percent, rounded to
+// two decimals, or nil when previous is zero.
+func growth(current, previous float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	pct := math.Round((current-previous)/previous*10000) / 100
+	return &pct
+}
+
+// ErrInvalidQuarter is returned for quarters outside 1-4.
+var ErrInvalidQuarter = apperr.New(apperr.ErrInvalid, "quarter must be between 1 and 4")
+
+// MonthAmount is the revenue of one month of a year.
+type MonthAmount struct {
+	Month  int     `json:"month"`
+	Amount float64 `json:"amount"`
+}
+
+// QuarterRevenue is the revenue of a quarter. Months without data are
+// listed in MissingMonths instead of counting as zero.
+type QuarterRevenue struct {
+	Quarter       int            `json:"quarter"`
+	Year          int            `json:"year"`
+	Revenue       float64        `json:"revenue"`
+	Currency      string         `json:"currency"`
+	Months        []MonthAmount  `json:"months"`
+	MissingMonths []int          `json:"missing_months"`
+	Complete      bool           `json:"complete"`
+	RatesUsed     []RateUsed     `json:"rates_used,omitempty"`
+	Filter        RevenueFilter  `json:"filter"`
+	Groups        []RevenueGroup `json:"groups,omitempty"`
+}
+
+// QuarterlyRevenue sums the revenue of a quarter, restricted to the rows
+// matching the filter, with one grouped query. groupBy adds per-group totals
+// and amounts are converted to currency as in SummarizeRevenue.
+func (c *DbConfig) QuarterlyRevenue(ctx context.Context, quarter, year int, filter RevenueFilter, groupBy []string, currency string) (*QuarterRevenue, error) {
+	if quarter < 1 || quarter > 4 {
+		return nil, fmt.Errorf("%w, got %d", ErrInvalidQuarter, quarter)
+	}
+	from := YearMonth{Year: year, Month: (quarter-1)*3 + 1}
+	to := from.AddMonths(2)
+
+	totals, err := c.convertedTotals(ctx, from, to, filter, groupBy, currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quarterly revenue: %w", err)
+	}
+	amounts := totals.monthAmounts()
+
+	result := &QuarterRevenue{
+		Quarter:       quarter,
+		Year:          year,
+		Currency:      totals.currency,
+		Months:        []MonthAmount{},
+		MissingMonths: []int{},
+		RatesUsed:     totals.rates,
+		Filter:        filter,
+		Groups:        totals.groups(groupBy, from, to),
+	}
+	for ym := from; ym.index() <= to.index(); ym = ym.AddMonths(1) {
+		amount, ok := amounts[ym]
+		if !ok {
+			result.MissingMonths = append(result.MissingMonths, ym.Month)
+			continue
+		}
+		result.Revenue += amount
+		result.Months = append(result.Months, MonthAmount{Month: ym.Month, Amount: amount})
+	}
+	result.Complete = len(result.MissingMonths) == 0
+
+	if !result.Complete {
+		log.Printf("quarter %d of %d is missing months %v", quarter, year, result.MissingMonths)
+	}
+	return result, nil
+}
+
+// MonthTotal is the revenue of one month.
+type MonthTotal struct {
+	Month     int            `json:"month"`
+	Year      int            `json:"year"`
+	Revenue   float64        `json:"revenue"`
+	Currency  string         `json:"currency"`
+	RatesUsed []RateUsed     `json:"rates_used,omitempty"`
+	Filter    RevenueFilter  `json:"filter"`
+	Groups    []RevenueGroup `json:"groups,omitempty"`
+}
+
+// MonthRevenue sums the revenue of one month over the rows matching the
+// filter, converted to currency as in SummarizeRevenue. It returns
+// ErrRevenueNotFound when no row matches.
+func (c *DbConfig) MonthRevenue(ctx context.Context, month, year int, filter RevenueFilter, groupBy []string, currency string) (*MonthTotal, error) {
+	if month < 1 || month > 12 {
+		return nil, apperr.Invalid("month", "month must be between 1 and 12, got %d", month)
+	}
+	ym := YearMonth{Year: year, Month: month}
+	totals, err := c.convertedTotals(ctx, ym, ym, filter, groupBy, currency)
+	if err != nil {
+		return nil, err
+	}
+	if len(totals.totals) == 0 {
+		return nil, fmt.Errorf("%w for month %d and year %d", ErrRevenueNotFound, month, year)
+	}
+
+	return &MonthTotal{
+		Month:     month,
+		Year:      year,
+		Revenue:   totals.monthAmounts()[ym],
+		Currency:  totals.currency,
+		RatesUsed: totals.rates,
+		Filter:    filter,
+		Groups:    totals.groups(groupBy, ym, ym),
+	}, nil
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// CacheEntry is a cached tool result, used by the database cache backend.
+type CacheEntry struct {
+	bun.BaseModel `bun:"table:tool_cache"`
+	Key           string    `bun:"key,pk"`
+	Tool          string    `bun:"tool,notnull"`
+	Value         []byte    `bun:"value"`
+	ExpiresAt     time.Time `bun:"expires_at,notnull"`
+}
+
+// GetCacheEntry returns an unexpired entry, or nil if there is none.
+func (c *DbConfig) GetCacheEntry(ctx context.Context, key string) (*CacheEntry, error) {
+	entry := &CacheEntry{}
+	err := c.db.NewSelect().
+		Model(entry).
+		Where("? = ? AND expires_at > ?", bun.Ident("key"), key, time.Now()).
+		Scan(ctx)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get cache entry: %w", err)
+	}
+	return entry, nil
+}
+
+func (c *DbConfig) SetCacheEntry(ctx context.Context, entry *CacheEntry) error {
+	query := c.db.NewInsert().Model(entry)
+	_, err := upsert(query, []string{"key"}, "tool", "value", "expires_at").Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to set cache entry: %w", err)
+	}
+	return nil
+}
+
+// DeleteCacheEntries removes every entry of a tool, and expired entries of
+// all tools.
+func (c *DbConfig) DeleteCacheEntries(ctx context.Context, tool string) error {
+	_, err := c.db.NewDelete().
+		Model((*CacheEntry)(nil)).
+		Where("tool = ? OR expires_at <= ?", tool, time.Now()).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to delete cache entries: %w", err)
+	}
+	return nil
+}
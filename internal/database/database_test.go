@@ -0,0 +1,311 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"tempfunctiontools/internal/apperr"
+)
+
+// newTestDB returns a migrated in-memory SQLite database.
+func newTestDB(t *testing.T) *DbConfig {
+	t.Helper()
+	db := &DbConfig{}
+	if err := db.InitDb(Options{Dialect: DialectSQLite, DSN: "file::memory:", AutoMigrate: true}); err != nil {
+		t.Fatalf("InitDb: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func usd(month, year int, amount float64) Revenue {
+	return Revenue{Month: month, Year: year, Amount: amount, Currency: DefaultCurrency}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	ms, err := db.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	if len(ms) == 0 || len(ms.Unapplied()) != 0 {
+		t.Fatalf("got %d migrations with %d pending, want all applied", len(ms), len(ms.Unapplied()))
+	}
+	if group, err := db.Migrate(ctx); err != nil || !group.IsZero() {
+		t.Fatalf("second Migrate applied %v, %v", group, err)
+	}
+
+	group, err := db.Rollback(ctx)
+	if err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if len(group.Migrations) != len(ms) {
+		t.Errorf("rolled back %d migrations, want %d", len(group.Migrations), len(ms))
+	}
+	if ms, _ := db.MigrationStatus(ctx); len(ms.Applied()) != 0 {
+		t.Errorf("%d migrations still applied", len(ms.Applied()))
+	}
+	if err := db.checkMigrations(ctx); err == nil {
+		t.Error("checkMigrations passed with pending migrations")
+	}
+
+	if _, err := db.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate after Rollback: %v", err)
+	}
+	if err := db.UpsertRevenues([]Revenue{usd(1, 2024, 10)}); err != nil {
+		t.Fatalf("schema not usable after migrating again: %v", err)
+	}
+}
+
+func TestRollbackRefusesSegmentedRevenue(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	if err := db.UpsertRevenues([]Revenue{
+		{Month: 1, Year: 2024, Amount: 10, Currency: DefaultCurrency, Region: "emea"},
+		{Month: 1, Year: 2024, Amount: 20, Currency: DefaultCurrency, Region: "apac"},
+	}); err != nil {
+		t.Fatalf("UpsertRevenues: %v", err)
+	}
+	if err := db.UpsertExchangeRates(ctx, []ExchangeRate{{Date: "2024-01-01", Base: "EUR", Quote: "USD", Rate: 1.1}}); err != nil {
+		t.Fatalf("UpsertExchangeRates: %v", err)
+	}
+
+	if _, err := db.Rollback(ctx); err == nil || !strings.Contains(err.Error(), "2 rows with a region") {
+		t.Fatalf("Rollback with segmented rows: got %v, want a refusal", err)
+	}
+	if ms, _ := db.MigrationStatus(ctx); len(ms.Unapplied()) != 0 {
+		t.Errorf("%d migrations rolled back by a refused rollback", len(ms.Unapplied()))
+	}
+	if rates, err := db.ListExchangeRates(ctx, "", ""); err != nil || len(rates) != 1 {
+		t.Errorf("exchange rates after a refused rollback: %v, %v", rates, err)
+	}
+	if _, err := db.MonthRevenue(ctx, 1, 2024, RevenueFilter{Region: "apac"}, nil, ""); err != nil {
+		t.Errorf("revenue after a refused rollback: %v", err)
+	}
+}
+
+func TestRevenueCRUD(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	changes := 0
+	db.OnChange(func(table string) {
+		if table == revenueTable {
+			changes++
+		}
+	})
+
+	revenue := usd(3, 2024, 100)
+	if err := db.CreateRevenue(ctx, &revenue); err != nil {
+		t.Fatalf("CreateRevenue: %v", err)
+	}
+	duplicate := usd(3, 2024, 5)
+	if err := db.CreateRevenue(ctx, &duplicate); !errors.Is(err, ErrRevenueExists) || !errors.Is(err, apperr.ErrConflict) {
+		t.Errorf("creating a duplicate: got %v, want ErrRevenueExists", err)
+	}
+	segment := Revenue{Month: 3, Year: 2024, Amount: 40, Currency: DefaultCurrency, Region: "emea"}
+	if err := db.CreateRevenue(ctx, &segment); err != nil {
+		t.Fatalf("CreateRevenue for a segment: %v", err)
+	}
+
+	updated, err := db.UpdateRevenue(ctx, revenue.Key(), 150, "EUR")
+	if err != nil {
+		t.Fatalf("UpdateRevenue: %v", err)
+	}
+	if updated.Amount != 150 || updated.Currency != "EUR" {
+		t.Errorf("updated row is %+v", updated)
+	}
+	if _, err := db.UpdateRevenue(ctx, RevenueKey{Month: 4, Year: 2024}, 1, ""); !errors.Is(err, ErrRevenueNotFound) {
+		t.Errorf("updating a missing row: got %v, want ErrRevenueNotFound", err)
+	}
+
+	if err := db.UpsertRevenues([]Revenue{usd(3, 2024, 175), usd(4, 2024, 80)}); err != nil {
+		t.Fatalf("UpsertRevenues: %v", err)
+	}
+	inserted, err := db.InsertMissingRevenues(ctx, []Revenue{usd(4, 2024, 1), usd(5, 2024, 90)})
+	if err != nil || inserted != 1 {
+		t.Errorf("InsertMissingRevenues inserted %d, %v, want 1", inserted, err)
+	}
+
+	var rows []Revenue
+	if err := db.EachRevenue(ctx, func(r Revenue) error {
+		rows = append(rows, r)
+		return nil
+	}); err != nil {
+		t.Fatalf("EachRevenue: %v", err)
+	}
+	amounts := map[RevenueKey]Revenue{}
+	for _, r := range rows {
+		amounts[r.Key()] = r
+	}
+	if len(rows) != 4 || amounts[revenue.Key()].Amount != 175 || amounts[revenue.Key()].Currency != DefaultCurrency ||
+		amounts[segment.Key()].Amount != 40 || amounts[RevenueKey{Month: 4, Year: 2024}].Amount != 80 {
+		t.Errorf("stored rows are %+v", rows)
+	}
+
+	if err := db.DeleteRevenue(ctx, segment.Key()); err != nil {
+		t.Fatalf("DeleteRevenue: %v", err)
+	}
+	if err := db.DeleteRevenue(ctx, segment.Key()); !errors.Is(err, ErrRevenueNotFound) || !errors.Is(err, apperr.ErrNotFound) {
+		t.Errorf("deleting twice: got %v, want ErrRevenueNotFound", err)
+	}
+	if changes != 6 {
+		t.Errorf("got %d change notifications, want 6", changes)
+	}
+}
+
+func TestAggregateRevenue(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	revenues := []Revenue{usd(1, 2023, 100), usd(2, 2023, 100), usd(3, 2023, 100)}
+	for month := 1; month <= 3; month++ {
+		revenues = append(revenues,
+			Revenue{Month: month, Year: 2024, Amount: 80, Currency: DefaultCurrency, Region: "emea", Channel: "online"},
+			Revenue{Month: month, Year: 2024, Amount: 40, Currency: DefaultCurrency, Region: "apac", Channel: "online"},
+		)
+	}
+	if err := db.UpsertRevenues(revenues); err != nil {
+		t.Fatalf("UpsertRevenues: %v", err)
+	}
+
+	month, err := db.MonthRevenue(ctx, 2, 2024, RevenueFilter{Region: "emea"}, nil, "")
+	if err != nil || month.Revenue != 80 {
+		t.Errorf("MonthRevenue for emea: %+v, %v", month, err)
+	}
+	if _, err := db.MonthRevenue(ctx, 5, 2024, RevenueFilter{}, nil, ""); !errors.Is(err, ErrRevenueNotFound) {
+		t.Errorf("MonthRevenue without data: got %v, want ErrRevenueNotFound", err)
+	}
+
+	quarter, err := db.QuarterlyRevenue(ctx, 1, 2024, RevenueFilter{}, []string{DimRegion}, "")
+	if err != nil {
+		t.Fatalf("QuarterlyRevenue: %v", err)
+	}
+	if quarter.Revenue != 360 || !quarter.Complete || len(quarter.Groups) != 2 {
+		t.Errorf("quarter is %+v", quarter)
+	}
+	if _, err := db.QuarterlyRevenue(ctx, 5, 2024, RevenueFilter{}, nil, ""); !errors.Is(err, apperr.ErrInvalid) {
+		t.Errorf("quarter 5: got %v, want an invalid input error", err)
+	}
+
+	summary, err := db.SummarizeRevenue(ctx, YearMonth{Year: 2024, Month: 1}, YearMonth{Year: 2024, Month: 3}, RevenueFilter{}, nil, "")
+	if err != nil {
+		t.Fatalf("SummarizeRevenue: %v", err)
+	}
+	if summary.Count != 3 || summary.Sum != 360 || summary.YoYGrowth == nil || *summary.YoYGrowth != 20 {
+		t.Errorf("summary is %+v", summary)
+	}
+	if summary.Months[1].MoMGrowth == nil || *summary.Months[1].MoMGrowth != 0 {
+		t.Errorf("month-over-month growth of February is %v", summary.Months[1].MoMGrowth)
+	}
+}
+
+func TestConvertCurrencies(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	if err := db.UpsertRevenues([]Revenue{
+		usd(1, 2024, 100),
+		{Month: 1, Year: 2024, Amount: 100, Currency: "EUR", Region: "emea"},
+		{Month: 2, Year: 2024, Amount: 100, Currency: "GBP", Region: "uk"},
+	}); err != nil {
+		t.Fatalf("UpsertRevenues: %v", err)
+	}
+	if err := db.UpsertExchangeRates(ctx, []ExchangeRate{
+		{Date: "2023-01-15", Base: "EUR", Quote: "USD", Rate: 1.1},
+		{Date: "2024-01-15", Base: "EUR", Quote: "USD", Rate: 1.1},
+		{Date: "2024-01-01", Base: "USD", Quote: "GBP", Rate: 0.8},
+	}); err != nil {
+		t.Fatalf("UpsertExchangeRates: %v", err)
+	}
+
+	if _, err := db.MonthRevenue(ctx, 1, 2024, RevenueFilter{}, nil, ""); !errors.Is(err, ErrMixedCurrencies) || !errors.Is(err, apperr.ErrUnprocessable) {
+		t.Errorf("mixed currencies without a target: got %v, want ErrMixedCurrencies", err)
+	}
+
+	month, err := db.MonthRevenue(ctx, 1, 2024, RevenueFilter{}, nil, "usd")
+	if err != nil {
+		t.Fatalf("MonthRevenue in USD: %v", err)
+	}
+	if month.Revenue != 210 || month.Currency != "USD" || len(month.RatesUsed) != 1 {
+		t.Errorf("January in USD is %+v", month)
+	}
+
+	// the stored rate is the other way round
+	month, err = db.MonthRevenue(ctx, 2, 2024, RevenueFilter{}, nil, "USD")
+	if err != nil || month.Revenue != 125 || !month.RatesUsed[0].Inverted {
+		t.Errorf("February in USD is %+v, %v", month, err)
+	}
+
+	// EUR to GBP is crossed through USD
+	month, err = db.MonthRevenue(ctx, 1, 2024, RevenueFilter{Region: "emea"}, nil, "GBP")
+	if err != nil {
+		t.Fatalf("MonthRevenue in GBP: %v", err)
+	}
+	if month.Revenue != 88 || len(month.RatesUsed) != 2 {
+		t.Errorf("January of emea in GBP is %+v", month)
+	}
+
+	// the comparison year does not decide the currency of the summary
+	if err := db.UpsertRevenues([]Revenue{{Month: 3, Year: 2023, Amount: 100, Currency: "EUR"}, usd(3, 2024, 121)}); err != nil {
+		t.Fatalf("UpsertRevenues: %v", err)
+	}
+	summary, err := db.SummarizeRevenue(ctx, YearMonth{Year: 2024, Month: 3}, YearMonth{Year: 2024, Month: 3}, RevenueFilter{}, nil, "")
+	if err != nil {
+		t.Fatalf("SummarizeRevenue over a single currency: %v", err)
+	}
+	if summary.Currency != "USD" || summary.PreviousPeriodSum == nil || *summary.PreviousPeriodSum != 110 || *summary.YoYGrowth != 10 {
+		t.Errorf("summary of March is %+v", summary)
+	}
+
+	if _, err := db.MonthRevenue(ctx, 1, 2024, RevenueFilter{}, nil, "JPY"); !errors.Is(err, ErrNoExchangeRate) {
+		t.Errorf("converting without a rate: got %v, want ErrNoExchangeRate", err)
+	}
+	if _, err := db.MonthRevenue(ctx, 1, 2024, RevenueFilter{}, nil, "dollars"); !errors.Is(err, ErrInvalidCurrency) {
+		t.Errorf("invalid currency: got %v, want ErrInvalidCurrency", err)
+	}
+}
+
+func TestQueryReadOnly(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	if err := db.UpsertRevenues([]Revenue{usd(1, 2024, 10), usd(2, 2024, 20), usd(3, 2024, 30)}); err != nil {
+		t.Fatalf("UpsertRevenues: %v", err)
+	}
+
+	result, err := db.QueryReadOnly(ctx, "SELECT month, amount FROM revenue WHERE amount > ? ORDER BY month;", 0, 15)
+	if err != nil {
+		t.Fatalf("QueryReadOnly: %v", err)
+	}
+	if len(result.Columns) != 2 || len(result.Rows) != 2 || result.Truncated {
+		t.Fatalf("result is %+v", result)
+	}
+	if result.Rows[0]["month"] != int64(2) || result.Rows[1]["amount"] != 30.0 {
+		t.Errorf("rows are %v", result.Rows)
+	}
+
+	result, err = db.QueryReadOnly(ctx, "SELECT * FROM revenue", 2)
+	if err != nil || len(result.Rows) != 2 || !result.Truncated {
+		t.Errorf("limited to 2 rows: %+v, %v", result, err)
+	}
+
+	for _, query := range []string{
+		"DELETE FROM revenue",
+		"SELECT 1; DELETE FROM revenue",
+		"WITH gone AS (DELETE FROM revenue RETURNING *) SELECT * FROM gone",
+	} {
+		if _, err := db.QueryReadOnly(ctx, query, 0); !errors.Is(err, ErrQueryRejected) {
+			t.Errorf("%q: got %v, want ErrQueryRejected", query, err)
+		}
+	}
+	result, err = db.QueryReadOnly(ctx, "SELECT COUNT(*) AS n FROM revenue", 0)
+	if err != nil || result.Rows[0]["n"] != int64(3) {
+		t.Errorf("rows were changed: %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/feature"
+	"github.com/uptrace/bun/dialect/mysqldialect"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+	"github.com/uptrace/bun/driver/sqliteshim"
+	"github.com/uptrace/bun/schema"
+)
+
+// Supported values of Options.Dialect.
+const (
+	DialectSQLite   = "sqlite"
+	DialectPostgres = "postgres"
+	DialectMySQL    = "mysql"
+)
+
+// defaultSQLiteDSN is the database file used when no DSN is configured.
+const defaultSQLiteDSN = "revenue.db"
+
+// Options configures how the database is opened.
+type Options struct {
+	// Dialect is sqlite (default), postgres or mysql.
+	Dialect string
+	// DSN is the SQLite file, revenue.db by default, or the Postgres or
+	// MySQL data source name.
+	DSN string
+	// AutoMigrate applies pending migrations in InitDb. Without it InitDb
+	// fails while migrations are pending.
+	AutoMigrate bool
+
+	// connection pool limits, zero keeps the database/sql default
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// openSQL opens the connection pool of the configured dialect and returns
+// it with its bun dialect.
+func openSQL(opts Options) (*sql.DB, schema.Dialect, error) {
+	var (
+		sqldb   *sql.DB
+		dialect schema.Dialect
+	)
+	switch strings.ToLower(opts.Dialect) {
+	case "", DialectSQLite:
+		dsn := opts.DSN
+		if dsn == "" {
+			dsn = defaultSQLiteDSN
+		}
+		db, err := sql.Open(sqliteshim.ShimName, dsn)
+		if err != nil {
+			return nil, nil, err
+		}
+		if strings.Contains(dsn, ":memory:") && opts.MaxOpenConns == 0 {
+			// every connection to an in-memory database gets its own,
+			// empty database
+			opts.MaxOpenConns = 1
+		}
+		sqldb, dialect = db, sqlitedialect.New()
+	case DialectPostgres:
+		if opts.DSN == "" {
+			return nil, nil, fmt.Errorf("a dsn is required for %s", DialectPostgres)
+		}
+		sqldb = sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(opts.DSN)))
+		dialect = pgdialect.New()
+	case DialectMySQL:
+		if opts.DSN == "" {
+			return nil, nil, fmt.Errorf("a dsn is required for %s", DialectMySQL)
+		}
+		cfg, err := mysql.ParseDSN(opts.DSN)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid mysql dsn: %w", err)
+		}
+		// timestamps are scanned into time.Time
+		cfg.ParseTime = true
+		db, err := sql.Open("mysql", cfg.FormatDSN())
+		if err != nil {
+			return nil, nil, err
+		}
+		sqldb, dialect = db, mysqldialect.New()
+	default:
+		return nil, nil, fmt.Errorf("unsupported database dialect %q, use %s, %s or %s", opts.Dialect, DialectSQLite, DialectPostgres, DialectMySQL)
+	}
+
+	if opts.MaxOpenConns > 0 {
+		sqldb.SetMaxOpenConns(opts.MaxOpenConns)
+	}
+	if opts.MaxIdleConns > 0 {
+		sqldb.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	if opts.ConnMaxLifetime > 0 {
+		sqldb.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	}
+	if opts.ConnMaxIdleTime > 0 {
+		sqldb.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	}
+	return sqldb, dialect, nil
+}
+
+// upsert makes an insert update the given columns of rows that already
+// exist with the same unique key: ON CONFLICT on SQLite and Postgres, ON
+// DUPLICATE KEY UPDATE on MySQL, which finds the key itself.
+func upsert(query *bun.InsertQuery, key []string, columns ...string) *bun.InsertQuery {
+	if query.DB().HasFeature(feature.InsertOnDuplicateKey) {
+		query.On("DUPLICATE KEY UPDATE")
+		for _, column := range columns {
+			query.Set("? = VALUES(?)", bun.Ident(column), bun.Ident(column))
+		}
+		return query
+	}
+
+	target := make([]any, len(key))
+	for i, column := range key {
+		target[i] = bun.Ident(column)
+	}
+	query.On("CONFLICT ("+strings.TrimSuffix(strings.Repeat("?, ", len(key)), ", ")+") DO UPDATE", target...)
+	for _, column := range columns {
+		query.Set("? = EXCLUDED.?", bun.Ident(column), bun.Ident(column))
+	}
+	return query
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"tempfunctiontools/internal/apperr"
+
+	"github.com/uptrace/bun"
+)
+
+// Revenue dimensions. Rows without a dimension store an empty string, so the
+// unique index treats them as equal.
+const (
+	DimRegion      = "region"
+	DimProductLine = "product_line"
+	DimChannel     = "channel"
+)
+
+// RevenueDimensions lists the dimension columns in index order.
+var RevenueDimensions = []string{DimRegion, DimProductLine, DimChannel}
+
+// revenueKeyColumns are the columns of the unique index of revenue.
+var revenueKeyColumns = []string{"month", "year", DimRegion, DimProductLine, DimChannel}
+
+// RevenueKey identifies one revenue row.
+type RevenueKey struct {
+	Month       int
+	Year        int
+	Region      string
+	ProductLine string
+	Channel     string
+}
+
+func (k RevenueKey) String() string {
+	s := fmt.Sprintf("month %d and year %d", k.Month, k.Year)
+	for _, dim := range []struct{ name, value string }{
+		{DimRegion, k.Region}, {DimProductLine, k.ProductLine}, {DimChannel, k.Channel},
+	} {
+		if dim.value != "" {
+			s += fmt.Sprintf(", %s %s", dim.name, dim.value)
+		}
+	}
+	return s
+}
+
+// condition returns a WHERE condition matching exactly this row.
+func (k RevenueKey) condition() (string, []any) {
+	return "month = ? AND year = ? AND region = ? AND product_line = ? AND channel = ?",
+		[]any{k.Month, k.Year, k.Region, k.ProductLine, k.Channel}
+}
+
+// Key returns the unique key of the row.
+func (r Revenue) Key() RevenueKey {
+	return RevenueKey{Month: r.Month, Year: r.Year, Region: r.Region, ProductLine: r.ProductLine, Channel: r.Channel}
+}
+
+// RevenueFilter restricts queries to dimension values. Empty fields match
+// every value.
+type RevenueFilter struct {
+	Region      string `json:"region,omitempty"`
+	ProductLine string `json:"product_line,omitempty"`
+	Channel     string `json:"channel,omitempty"`
+}
+
+func (f RevenueFilter) apply(q *bun.SelectQuery) *bun.SelectQuery {
+	if f.Region != "" {
+		q = q.Where("region = ?", f.Region)
+	}
+	if f.ProductLine != "" {
+		q = q.Where("product_line = ?", f.ProductLine)
+	}
+	if f.Channel != "" {
+		q = q.Where("channel = ?", f.Channel)
+	}
+	return q
+}
+
+// ParseGroupBy validates dimension names from a comma-separated list.
+func ParseGroupBy(values ...string) ([]string, error) {
+	var dims []string
+	seen := map[string]bool{}
+	for _, value := range values {
+		for _, dim := range strings.Split(value, ",") {
+			dim = strings.ToLower(strings.TrimSpace(dim))
+			if dim == "" || seen[dim] {
+				continue
+			}
+			if !isDimension(dim) {
+				return nil, apperr.Invalid("group_by", "cannot group by %q, use %s", dim, strings.Join(RevenueDimensions, ", "))
+			}
+			seen[dim] = true
+			dims = append(dims, dim)
+		}
+	}
+	return dims, nil
+}
+
+func isDimension(name string) bool {
+	for _, dim := range RevenueDimensions {
+		if dim == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RevenueGroup is the revenue of one combination of the grouped dimensions.
+// Dimensions that are not grouped by are left empty.
+type RevenueGroup struct {
+	Region      string  `json:"region,omitempty"`
+	ProductLine string  `json:"product_line,omitempty"`
+	Channel     string  `json:"channel,omitempty"`
+	Revenue     float64 `json:"revenue"`
+	Rows        int     `json:"rows"`
+}
+
+// dimension returns the value of a dimension column.
+func (g RevenueGroup) dimension(name string) string {
+	switch name {
+	case DimRegion:
+		return g.Region
+	case DimProductLine:
+		return g.ProductLine
+	case DimChannel:
+		return g.Channel
+	}
+	return ""
+}
@@ -0,0 +1,270 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"tempfunctiontools/internal/apperr"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	exchangeRatesTable = "exchange_rates"
+
+	// DefaultCurrency is the currency of revenue rows stored without one.
+	DefaultCurrency = "USD"
+)
+
+var (
+	ErrInvalidCurrency  = apperr.New(apperr.ErrInvalid, "invalid currency")
+	ErrNoExchangeRate   = apperr.New(apperr.ErrUnprocessable, "no exchange rate")
+	ErrMixedCurrencies  = apperr.New(apperr.ErrUnprocessable, "revenue is in several currencies")
+	currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// ExchangeRate says that one unit of Base is worth Rate units of Quote on
+// Date (YYYY-MM-DD).
+type ExchangeRate struct {
+	bun.BaseModel `bun:"table:exchange_rates"`
+	ID            int64   `bun:"id,pk,autoincrement" json:"-"`
+	Date          string  `bun:"date,notnull" json:"date"`
+	Base          string  `bun:"base,notnull" json:"base"`
+	Quote         string  `bun:"quote,notnull" json:"quote"`
+	Rate          float64 `bun:"rate,notnull" json:"rate"`
+}
+
+// Validate checks the date, the currency codes and that the rate is
+// positive. Currency codes are upper-cased.
+func (r *ExchangeRate) Validate() error {
+	if _, err := time.Parse(time.DateOnly, r.Date); err != nil {
+		return apperr.Invalid("date", "invalid date %q, use YYYY-MM-DD", r.Date)
+	}
+	var err error
+	if r.Base, err = NormalizeCurrency(r.Base); err != nil {
+		return err
+	}
+	if r.Quote, err = NormalizeCurrency(r.Quote); err != nil {
+		return err
+	}
+	if r.Base == r.Quote {
+		return apperr.Invalid("quote", "base and quote are both %s", r.Base)
+	}
+	if r.Rate <= 0 {
+		return apperr.Invalid("rate", "rate must be positive, got %v", r.Rate)
+	}
+	return nil
+}
+
+// NormalizeCurrency upper-cases an ISO 4217 code and checks its shape.
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !currencyCodePattern.MatchString(code) {
+		return "", fmt.Errorf("%w %q, use a three letter code such as USD", ErrInvalidCurrency, code)
+	}
+	return code, nil
+}
+
+// CurrencyOrDefault upper-cases a currency code, using DefaultCurrency when
+// it is empty. The result is checked when the row is validated.
+func CurrencyOrDefault(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return DefaultCurrency
+	}
+	return code
+}
+
+// RateUsed records an exchange rate applied to a conversion.
+type RateUsed struct {
+	From string  `json:"from"`
+	To   string  `json:"to"`
+	Date string  `json:"date"`
+	Rate float64 `json:"rate"`
+	// Inverted is set when the rate was stored the other way round.
+	Inverted bool `json:"inverted,omitempty"`
+}
+
+// UpsertExchangeRates stores rates, replacing the rate of an existing date
+// and pair.
+func (c *DbConfig) UpsertExchangeRates(ctx context.Context, rates []ExchangeRate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+	query := c.db.NewInsert().Model(&rates)
+	_, err := upsert(query, []string{"date", "base", "quote"}, "rate").Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to upsert exchange rates: %w", err)
+	}
+	c.notifyChange(exchangeRatesTable)
+	return nil
+}
+
+// ListExchangeRates returns stored rates ordered by date, optionally for one
+// base or quote currency.
+func (c *DbConfig) ListExchangeRates(ctx context.Context, base, quote string) ([]ExchangeRate, error) {
+	rates := []ExchangeRate{}
+	query := c.db.NewSelect().Model(&rates).Order("date", "base", "quote")
+	if base != "" {
+		query.Where("base = ?", strings.ToUpper(base))
+	}
+	if quote != "" {
+		query.Where("quote = ?", strings.ToUpper(quote))
+	}
+	if err := query.Scan(ctx); err != nil {
+		return nil, fmt.Errorf("failed to list exchange rates: %w", err)
+	}
+	return rates, nil
+}
+
+// latestRate returns the rate from one currency to another on the latest
+// date not after the given one, using the inverse pair when only that is
+// stored.
+func (c *DbConfig) latestRate(ctx context.Context, from, to, date string) (RateUsed, error) {
+	var rate ExchangeRate
+	err := c.db.NewSelect().
+		Model(&rate).
+		Where("date <= ?", date).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("base = ? AND quote = ?", from, to).
+				WhereOr("base = ? AND quote = ?", to, from)
+		}).
+		Order("date DESC").
+		Limit(1).
+		Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return RateUsed{}, fmt.Errorf("%w from %s to %s on or before %s", ErrNoExchangeRate, from, to, date)
+		}
+		return RateUsed{}, fmt.Errorf("failed to get exchange rate: %w", err)
+	}
+
+	used := RateUsed{From: from, To: to, Date: rate.Date, Rate: rate.Rate}
+	if rate.Base != from {
+		used.Rate = 1 / rate.Rate
+		used.Inverted = true
+	}
+	return used, nil
+}
+
+// converter converts monthly amounts to one currency with the rate in force
+// at the end of each month, rounded to cents, remembering the rates it used.
+// Pairs without a stored rate are crossed through DefaultCurrency.
+type converter struct {
+	db     *DbConfig
+	ctx    context.Context
+	target string
+	rates  map[string][]RateUsed
+}
+
+func (cv *converter) convert(amount float64, currency string, ym YearMonth) (float64, error) {
+	if currency == cv.target {
+		return amount, nil
+	}
+
+	date := ym.lastDay()
+	key := currency + "/" + date
+	rates, ok := cv.rates[key]
+	if !ok {
+		var err error
+		if rates, err = cv.lookup(currency, date); err != nil {
+			return 0, err
+		}
+		cv.rates[key] = rates
+	}
+
+	for _, rate := range rates {
+		amount *= rate.Rate
+	}
+	return math.Round(amount*100) / 100, nil
+}
+
+// lookup finds the rate from currency to the target, or the two rates of a
+// conversion through DefaultCurrency.
+func (cv *converter) lookup(currency, date string) ([]RateUsed, error) {
+	rate, err := cv.db.latestRate(cv.ctx, currency, cv.target, date)
+	if err == nil {
+		return []RateUsed{rate}, nil
+	}
+	if !errors.Is(err, ErrNoExchangeRate) || currency == DefaultCurrency || cv.target == DefaultCurrency {
+		return nil, err
+	}
+
+	first, crossErr := cv.db.latestRate(cv.ctx, currency, DefaultCurrency, date)
+	if crossErr != nil {
+		return nil, err
+	}
+	second, crossErr := cv.db.latestRate(cv.ctx, DefaultCurrency, cv.target, date)
+	if crossErr != nil {
+		return nil, err
+	}
+	return []RateUsed{first, second}, nil
+}
+
+// used returns the distinct rates applied, ordered by date and pair.
+func (cv *converter) used() []RateUsed {
+	seen := map[RateUsed]bool{}
+	used := []RateUsed{}
+	for _, rates := range cv.rates {
+		for _, rate := range rates {
+			if !seen[rate] {
+				seen[rate] = true
+				used = append(used, rate)
+			}
+		}
+	}
+	sort.Slice(used, func(i, j int) bool {
+		if used[i].Date != used[j].Date {
+			return used[i].Date < used[j].Date
+		}
+		return used[i].From < used[j].From
+	})
+	return used
+}
+
+// convertTotals converts the totals in place to the target currency. An
+// empty target keeps the currency the totals share and fails if they use
+// several. It returns the currency of the result and the rates used.
+func (c *DbConfig) convertTotals(ctx context.Context, totals []revenueTotal, target string) (string, []RateUsed, error) {
+	if target == "" {
+		currencies := map[string]bool{}
+		for _, total := range totals {
+			currencies[total.Currency] = true
+		}
+		if len(currencies) > 1 {
+			names := make([]string, 0, len(currencies))
+			for name := range currencies {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return "", nil, fmt.Errorf("%w (%s), give a target currency", ErrMixedCurrencies, strings.Join(names, ", "))
+		}
+		for name := range currencies {
+			return name, nil, nil
+		}
+		return DefaultCurrency, nil, nil
+	}
+
+	target, err := NormalizeCurrency(target)
+	if err != nil {
+		return "", nil, err
+	}
+
+	cv := &converter{db: c, ctx: ctx, target: target, rates: map[string][]RateUsed{}}
+	for i := range totals {
+		total := &totals[i]
+		ym := YearMonth{Year: total.Year, Month: total.Month}
+		if total.Amount, err = cv.convert(total.Amount, total.Currency, ym); err != nil {
+			return "", nil, err
+		}
+		total.Currency = target
+	}
+	return target, cv.used(), nil
+}
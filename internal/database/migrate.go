@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"tempfunctiontools/internal/database/migrations"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/migrate"
+)
+
+// migrationTable records the applied migrations.
+const migrationTable = "bun_migrations"
+
+func (c *DbConfig) migrator() *migrate.Migrator {
+	return migrate.NewMigrator(c.db, migrations.Migrations, migrate.WithTableName(migrationTable))
+}
+
+// inMigrationTx runs fn in one transaction, except on MySQL, where schema
+// changes commit implicitly and a transaction would not undo them.
+func (c *DbConfig) inMigrationTx(ctx context.Context, fn func(ctx context.Context, db bun.IDB) error) error {
+	if c.Dialect() == DialectMySQL {
+		return fn(ctx, c.db)
+	}
+	return c.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return fn(migrations.WithTx(ctx, tx), tx)
+	})
+}
+
+// Migrate applies the pending migrations as one group and returns it. The
+// group is empty when the schema is up to date. Where the dialect allows,
+// the group runs in a transaction and a failure leaves none of it applied.
+func (c *DbConfig) Migrate(ctx context.Context) (*migrate.MigrationGroup, error) {
+	migrator := c.migrator()
+	if err := migrator.Init(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create migration tables: %w", err)
+	}
+	if err := migrator.Lock(ctx); err != nil {
+		return nil, fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer migrator.Unlock(ctx)
+
+	ms, err := migrator.MigrationsWithStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	pending := ms.Unapplied()
+	if len(pending) == 0 {
+		return &migrate.MigrationGroup{}, nil
+	}
+	group := &migrate.MigrationGroup{ID: ms.LastGroupID() + 1}
+
+	err = c.inMigrationTx(ctx, func(ctx context.Context, db bun.IDB) error {
+		for i := range pending {
+			m := &pending[i]
+			m.GroupID = group.ID
+			if m.Up != nil {
+				if err := m.Up(ctx, c.db); err != nil {
+					return fmt.Errorf("%s: %w", m, err)
+				}
+			}
+			if _, err := db.NewInsert().Model(m).ModelTableExpr(migrationTable).Exec(ctx); err != nil {
+				return fmt.Errorf("failed to mark %s applied: %w", m, err)
+			}
+			group.Migrations = pending[:i+1]
+		}
+		return nil
+	})
+	if err != nil {
+		return group, fmt.Errorf("failed to migrate: %w", err)
+	}
+	log.Printf("applied migrations %s", group)
+	return group, nil
+}
+
+// Rollback reverts the last group of migrations and returns it. Down checks
+// of the group run first, so a refused rollback changes nothing; where the
+// dialect allows, the group runs in a transaction like in Migrate.
+func (c *DbConfig) Rollback(ctx context.Context) (*migrate.MigrationGroup, error) {
+	migrator := c.migrator()
+	if err := migrator.Init(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create migration tables: %w", err)
+	}
+	if err := migrator.Lock(ctx); err != nil {
+		return nil, fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer migrator.Unlock(ctx)
+
+	ms, err := migrator.MigrationsWithStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	group := ms.LastGroup()
+	if group.IsZero() {
+		return group, nil
+	}
+
+	err = c.inMigrationTx(ctx, func(ctx context.Context, db bun.IDB) error {
+		if err := migrations.CheckDown(ctx, db, group.Migrations); err != nil {
+			return err
+		}
+		for i := len(group.Migrations) - 1; i >= 0; i-- {
+			m := &group.Migrations[i]
+			if m.Down != nil {
+				if err := m.Down(ctx, c.db); err != nil {
+					return fmt.Errorf("%s: %w", m, err)
+				}
+			}
+			if _, err := db.NewDelete().Model(m).ModelTableExpr(migrationTable).Where("id = ?", m.ID).Exec(ctx); err != nil {
+				return fmt.Errorf("failed to mark %s unapplied: %w", m, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return group, fmt.Errorf("failed to roll back: %w", err)
+	}
+	log.Printf("rolled back migrations %s", group)
+	return group, nil
+}
+
+// MigrationStatus lists every migration with the group it was applied in,
+// zero for pending ones.
+func (c *DbConfig) MigrationStatus(ctx context.Context) (migrate.MigrationSlice, error) {
+	migrator := c.migrator()
+	if err := migrator.Init(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create migration tables: %w", err)
+	}
+	ms, err := migrator.MigrationsWithStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	return ms, nil
+}
+
+// checkMigrations fails when migrations are pending.
+func (c *DbConfig) checkMigrations(ctx context.Context) error {
+	ms, err := c.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	pending := ms.Unapplied()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(pending))
+	for _, m := range pending {
+		names = append(names, m.String())
+	}
+	return fmt.Errorf("database has %d pending migrations (%s), run `migrate up` or enable database.auto_migrate", len(pending), strings.Join(names, ", "))
+}
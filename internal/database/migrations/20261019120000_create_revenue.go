@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+// revenueV1 is the revenue table before dimensions and currencies.
+type revenueV1 struct {
+	bun.BaseModel `bun:"table:revenue"`
+	ID            int     `bun:"id,pk,autoincrement"`
+	Month         int     `bun:"month,notnull"`
+	Year          int     `bun:"year,notnull"`
+	Amount        float64 `bun:"amount"`
+}
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, bunDB *bun.DB) error {
+		db := conn(ctx, bunDB)
+		// a table created before migrations may already have later
+		// columns and indexes, the following migrations catch it up
+		if tableExists(ctx, db, "revenue") {
+			return nil
+		}
+		return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			if err := createTable(ctx, tx, (*revenueV1)(nil)); err != nil {
+				return err
+			}
+			return createIndex(ctx, tx, (*revenueV1)(nil), "idx_month_year", true, "month", "year")
+		})
+	}, func(ctx context.Context, bunDB *bun.DB) error {
+		db := conn(ctx, bunDB)
+		return dropTable(ctx, db, (*revenueV1)(nil))
+	})
+}
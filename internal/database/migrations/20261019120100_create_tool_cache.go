@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// toolCacheV1 holds the entries of the SQLite tool result cache.
+type toolCacheV1 struct {
+	bun.BaseModel `bun:"table:tool_cache"`
+	Key           string    `bun:"key,pk"`
+	Tool          string    `bun:"tool,notnull"`
+	Value         []byte    `bun:"value"`
+	ExpiresAt     time.Time `bun:"expires_at,notnull"`
+}
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, bunDB *bun.DB) error {
+		db := conn(ctx, bunDB)
+		return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			if err := createTable(ctx, tx, (*toolCacheV1)(nil)); err != nil {
+				return err
+			}
+			return createIndex(ctx, tx, (*toolCacheV1)(nil), "idx_tool_cache_tool", false, "tool")
+		})
+	}, func(ctx context.Context, bunDB *bun.DB) error {
+		db := conn(ctx, bunDB)
+		return dropTable(ctx, db, (*toolCacheV1)(nil))
+	})
+}
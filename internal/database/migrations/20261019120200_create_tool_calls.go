@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// toolCallsV1 is the tool call audit log before aliases were recorded.
+type toolCallsV1 struct {
+	bun.BaseModel  `bun:"table:tool_calls"`
+	ID             int64     `bun:"id,pk,autoincrement"`
+	ConversationID string    `bun:"conversation_id"`
+	RequestID      string    `bun:"request_id"`
+	ToolCallID     string    `bun:"tool_call_id"`
+	ToolName       string    `bun:"tool_name,notnull"`
+	Arguments      string    `bun:"arguments"`
+	Result         string    `bun:"result"`
+	Error          string    `bun:"error"`
+	Status         string    `bun:"status,notnull"`
+	DurationMs     int64     `bun:"duration_ms"`
+	CreatedAt      time.Time `bun:"created_at,notnull"`
+}
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, bunDB *bun.DB) error {
+		db := conn(ctx, bunDB)
+		return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			if err := createTable(ctx, tx, (*toolCallsV1)(nil)); err != nil {
+				return err
+			}
+			return createIndex(ctx, tx, (*toolCallsV1)(nil), "idx_tool_calls_tool_created", false, "tool_name", "created_at")
+		})
+	}, func(ctx context.Context, bunDB *bun.DB) error {
+		db := conn(ctx, bunDB)
+		return dropTable(ctx, db, (*toolCallsV1)(nil))
+	})
+}
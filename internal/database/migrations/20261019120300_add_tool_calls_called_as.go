@@ -0,0 +1,20 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+// called_as records the alias a tool was called by.
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, bunDB *bun.DB) error {
+		db := conn(ctx, bunDB)
+		return addColumns(ctx, db, (*toolCallsV1)(nil), "tool_calls", [][2]string{
+			{"called_as", "VARCHAR(255)"},
+		})
+	}, func(ctx context.Context, bunDB *bun.DB) error {
+		db := conn(ctx, bunDB)
+		return dropColumns(ctx, db, (*toolCallsV1)(nil), "tool_calls", "called_as")
+	})
+}
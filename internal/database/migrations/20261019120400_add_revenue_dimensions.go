@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/uptrace/bun"
+)
+
+// Region, product line and channel columns, with the month/year unique index
+// widened to include them. Rows stored before have empty dimensions.
+// Rolling back is refused while segmented rows exist: dropping the columns
+// would merge them into duplicate months the old index does not allow.
+func init() {
+	downChecks["20261019120400"] = func(ctx context.Context, db bun.IDB) error {
+		count, err := db.NewSelect().
+			Model((*revenueV1)(nil)).
+			Where("region <> '' OR product_line <> '' OR channel <> ''").
+			Count(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to count segmented revenue: %w", err)
+		}
+		if count > 0 {
+			return fmt.Errorf("revenue has %d rows with a region, product line or channel, delete them first", count)
+		}
+		return nil
+	}
+
+	Migrations.MustRegister(func(ctx context.Context, bunDB *bun.DB) error {
+		db := conn(ctx, bunDB)
+		return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			err := addColumns(ctx, tx, (*revenueV1)(nil), "revenue", [][2]string{
+				{"region", "VARCHAR(255) NOT NULL DEFAULT ''"},
+				{"product_line", "VARCHAR(255) NOT NULL DEFAULT ''"},
+				{"channel", "VARCHAR(255) NOT NULL DEFAULT ''"},
+			})
+			if err != nil {
+				return err
+			}
+			if err := dropIndex(ctx, tx, (*revenueV1)(nil), "idx_month_year"); err != nil {
+				return err
+			}
+			return createIndex(ctx, tx, (*revenueV1)(nil), "idx_revenue_month_year_dimensions", true,
+				"month", "year", "region", "product_line", "channel")
+		})
+	}, func(ctx context.Context, bunDB *bun.DB) error {
+		db := conn(ctx, bunDB)
+		return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			if err := dropIndex(ctx, tx, (*revenueV1)(nil), "idx_revenue_month_year_dimensions"); err != nil {
+				return err
+			}
+			if err := dropColumns(ctx, tx, (*revenueV1)(nil), "revenue", "region", "product_line", "channel"); err != nil {
+				return err
+			}
+			return createIndex(ctx, tx, (*revenueV1)(nil), "idx_month_year", true, "month", "year")
+		})
+	})
+}
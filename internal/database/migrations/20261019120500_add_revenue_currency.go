@@ -0,0 +1,20 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+// The currency of each revenue row. Rows stored before are in USD.
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, bunDB *bun.DB) error {
+		db := conn(ctx, bunDB)
+		return addColumns(ctx, db, (*revenueV1)(nil), "revenue", [][2]string{
+			{"currency", "VARCHAR(255) NOT NULL DEFAULT 'USD'"},
+		})
+	}, func(ctx context.Context, bunDB *bun.DB) error {
+		db := conn(ctx, bunDB)
+		return dropColumns(ctx, db, (*revenueV1)(nil), "revenue", "currency")
+	})
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+// exchangeRatesV1 holds the rates used to convert revenue between currencies.
+type exchangeRatesV1 struct {
+	bun.BaseModel `bun:"table:exchange_rates"`
+	ID            int64   `bun:"id,pk,autoincrement"`
+	Date          string  `bun:"date,notnull"`
+	Base          string  `bun:"base,notnull"`
+	Quote         string  `bun:"quote,notnull"`
+	Rate          float64 `bun:"rate,notnull"`
+}
+
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, bunDB *bun.DB) error {
+		db := conn(ctx, bunDB)
+		return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			if err := createTable(ctx, tx, (*exchangeRatesV1)(nil)); err != nil {
+				return err
+			}
+			return createIndex(ctx, tx, (*exchangeRatesV1)(nil), "idx_exchange_rates_date_pair", true, "date", "base", "quote")
+		})
+	}, func(ctx context.Context, bunDB *bun.DB) error {
+		db := conn(ctx, bunDB)
+		return dropTable(ctx, db, (*exchangeRatesV1)(nil))
+	})
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+)
+
+// MySQL maps Go strings to VARCHAR(255) and []byte to BLOB, too small for
+// tool arguments, results and cached values. SQLite and Postgres do not
+// limit them, so this only changes MySQL.
+func init() {
+	Migrations.MustRegister(func(ctx context.Context, bunDB *bun.DB) error {
+		db := conn(ctx, bunDB)
+		if !mysql(db) {
+			return nil
+		}
+		for _, query := range []string{
+			"ALTER TABLE tool_calls MODIFY arguments MEDIUMTEXT, MODIFY result MEDIUMTEXT, MODIFY error TEXT",
+			"ALTER TABLE tool_cache MODIFY value MEDIUMBLOB",
+		} {
+			if _, err := db.ExecContext(ctx, query); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(ctx context.Context, db *bun.DB) error {
+		// narrowing would cut stored values
+		return nil
+	})
+}
@@ -0,0 +1,195 @@
+// Package migrations holds the versioned schema changes of the application
+// database. Each file registers one migration named after its timestamp.
+//
+// Migrations written before versioning existed are idempotent so databases
+// created by the earlier IfNotExists code are adopted on their first run.
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/migrate"
+)
+
+// Migrations are applied in name order.
+var Migrations = migrate.NewMigrations()
+
+// downChecks holds, by migration name, checks that refuse to roll the
+// migration back, for example when that would fail or lose data.
+var downChecks = map[string]func(ctx context.Context, db bun.IDB) error{}
+
+// CheckDown runs the down checks of a group of migrations, so a rollback
+// can be refused before any migration of the group is reverted.
+func CheckDown(ctx context.Context, db bun.IDB, ms migrate.MigrationSlice) error {
+	for _, m := range ms {
+		check, ok := downChecks[m.Name]
+		if !ok {
+			continue
+		}
+		if err := check(ctx, db); err != nil {
+			return fmt.Errorf("cannot roll back %s: %w", m, err)
+		}
+	}
+	return nil
+}
+
+type txKey struct{}
+
+// WithTx returns a context under which migrations run their statements in
+// tx, so a group of them is applied or rolled back as a whole.
+func WithTx(ctx context.Context, tx bun.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// conn returns the transaction of the group being run, or db when the
+// group does not run in one.
+func conn(ctx context.Context, db *bun.DB) bun.IDB {
+	if tx, ok := ctx.Value(txKey{}).(bun.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// createTable creates the table of a model unless it exists.
+func createTable(ctx context.Context, db bun.IDB, model any) error {
+	_, err := db.NewCreateTable().Model(model).IfNotExists().Exec(ctx)
+	return err
+}
+
+// dropTable drops the table of a model if it exists.
+func dropTable(ctx context.Context, db bun.IDB, model any) error {
+	_, err := db.NewDropTable().Model(model).IfExists().Exec(ctx)
+	return err
+}
+
+// tableName returns the table of a model.
+func tableName(db bun.IDB, model any) string {
+	return db.Dialect().Tables().Get(reflect.TypeOf(model).Elem()).Name
+}
+
+// mysql reports whether db is MySQL, which has no IF [NOT] EXISTS for
+// indexes and drops them per table.
+func mysql(db bun.IDB) bool {
+	return db.Dialect().Name() == dialect.MySQL
+}
+
+// indexExists reports whether a MySQL table has an index.
+func indexExists(ctx context.Context, db bun.IDB, table, name string) (bool, error) {
+	var count int
+	err := db.NewRaw(
+		"SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?",
+		table, name,
+	).Scan(ctx, &count)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up index %s: %w", name, err)
+	}
+	return count > 0, nil
+}
+
+// createIndex creates an index on the table of a model unless it exists.
+func createIndex(ctx context.Context, db bun.IDB, model any, name string, unique bool, columns ...string) error {
+	query := db.NewCreateIndex().Model(model).Index(name).Column(columns...)
+	if mysql(db) {
+		exists, err := indexExists(ctx, db, tableName(db, model), name)
+		if err != nil || exists {
+			return err
+		}
+	} else {
+		query.IfNotExists()
+	}
+	if unique {
+		query.Unique()
+	}
+	if _, err := query.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to create index %s: %w", name, err)
+	}
+	return nil
+}
+
+// dropIndex drops an index if it exists.
+func dropIndex(ctx context.Context, db bun.IDB, model any, name string) error {
+	query := db.NewDropIndex().Model(model)
+	if mysql(db) {
+		table := tableName(db, model)
+		exists, err := indexExists(ctx, db, table, name)
+		if err != nil || !exists {
+			return err
+		}
+		query.Index("? ON ?", bun.Ident(name), bun.Ident(table))
+	} else {
+		query.Index(name).IfExists()
+	}
+	if _, err := query.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to drop index %s: %w", name, err)
+	}
+	return nil
+}
+
+// columns returns the column names of a table.
+func columns(ctx context.Context, db bun.IDB, table string) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s LIMIT 0", table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s columns: %w", table, err)
+	}
+	defer rows.Close()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s columns: %w", table, err)
+	}
+	existing := make(map[string]bool, len(names))
+	for _, name := range names {
+		existing[name] = true
+	}
+	return existing, nil
+}
+
+// tableExists reports whether a table can be read. The read runs in its own
+// (nested) transaction: on Postgres a failed statement aborts the
+// transaction it runs in.
+func tableExists(ctx context.Context, db bun.IDB, table string) bool {
+	err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := columns(ctx, tx, table)
+		return err
+	})
+	return err == nil
+}
+
+// addColumns adds the columns, given as name and definition, that the
+// table of a model does not have yet.
+func addColumns(ctx context.Context, db bun.IDB, model any, table string, definitions [][2]string) error {
+	existing, err := columns(ctx, db, table)
+	if err != nil {
+		return err
+	}
+	for _, column := range definitions {
+		if existing[column[0]] {
+			continue
+		}
+		if _, err := db.NewAddColumn().Model(model).ColumnExpr(column[0] + " " + column[1]).Exec(ctx); err != nil {
+			return fmt.Errorf("failed to add column %s to %s: %w", column[0], table, err)
+		}
+	}
+	return nil
+}
+
+// dropColumns drops the columns the table of a model has.
+func dropColumns(ctx context.Context, db bun.IDB, model any, table string, names ...string) error {
+	existing, err := columns(ctx, db, table)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !existing[name] {
+			continue
+		}
+		if _, err := db.NewDropColumn().Model(model).Column(name).Exec(ctx); err != nil {
+			return fmt.Errorf("failed to drop column %s from %s: %w", name, table, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// QueryResult holds the rows of a read-only query.
+type QueryResult struct {
+	Columns   []string         `json:"columns"`
+	Rows      []map[string]any `json:"rows"`
+	Truncated bool             `json:"truncated,omitempty"`
+}
+
+// Values returns the rows as lists in column order.
+func (r *QueryResult) Values() [][]any {
+	values := make([][]any, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		list := make([]any, len(r.Columns))
+		for i, column := range r.Columns {
+			list[i] = row[column]
+		}
+		values = append(values, list)
+	}
+	return values
+}
+
+// QueryReadOnly runs a single SELECT statement and returns at most maxRows
+// rows. The query runs inside a transaction that is always rolled back, so it
+// cannot change data even if the statement check is bypassed.
+func (c *DbConfig) QueryReadOnly(ctx context.Context, query string, maxRows int, args ...any) (*QueryResult, error) {
+	query = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(query), ";"))
+	if _, err := readOnlyTokens(c.Dialect(), query); err != nil {
+		return nil, err
+	}
+
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run query: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+
+	result := &QueryResult{Columns: columns, Rows: []map[string]any{}}
+	for rows.Next() {
+		if maxRows > 0 && len(result.Rows) >= maxRows {
+			result.Truncated = true
+			break
+		}
+
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				row[column] = string(b)
+			} else {
+				row[column] = values[i]
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+
+	return result, nil
+}
@@ -2,99 +2,256 @@ package database
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"log"
+	"sync"
+
+	"tempfunctiontools/internal/apperr"
 
 	"github.com/uptrace/bun"
-	"github.com/uptrace/bun/dialect/sqlitedialect"
-	"github.com/uptrace/bun/driver/sqliteshim"
 )
 
 const (
-	databaseName = "revenue.db"
+	revenueTable = "revenue"
+
+	// accepted range of revenue years
+	MinRevenueYear = 1900
+	MaxRevenueYear = 2100
+)
+
+var (
+	ErrRevenueNotFound = apperr.New(apperr.ErrNotFound, "revenue not found")
+	ErrRevenueExists   = apperr.New(apperr.ErrConflict, "revenue already exists")
 )
 
 type DbConfig struct {
 	db  *bun.DB
 	ctx context.Context
+
+	mu        sync.RWMutex
+	listeners []func(table string)
 }
 
 type Revenue struct {
 	bun.BaseModel `bun:"table:revenue"`
-	ID            int     `bun:"id,pk,autoincrement"`
-	Month         int     `bun:"month,notnull"`
-	Year          int     `bun:"year,notnull"`
-	Amount        float64 `bun:"amount"`
+	ID            int     `bun:"id,pk,autoincrement" json:"id"`
+	Month         int     `bun:"month,notnull" json:"month"`
+	Year          int     `bun:"year,notnull" json:"year"`
+	Amount        float64 `bun:"amount" json:"amount"`
+	// Currency is the ISO 4217 code of Amount
+	Currency string `bun:"currency,notnull,default:'USD'" json:"currency"`
+
+	// optional dimensions, empty when the row is not segmented. They have
+	// no default tag: bun leaves out defaulted columns that are empty in the
+	// first row of a bulk insert, which dropped the dimensions of later rows.
+	Region      string `bun:"region,notnull" json:"region,omitempty"`
+	ProductLine string `bun:"product_line,notnull" json:"product_line,omitempty"`
+	Channel     string `bun:"channel,notnull" json:"channel,omitempty"`
+}
+
+// Validate checks that the row can be stored: month 1-12, a year between
+// MinRevenueYear and MaxRevenueYear, a non-negative amount and an upper-case
+// currency code.
+func (r Revenue) Validate() error {
+	if r.Month < 1 || r.Month > 12 {
+		return apperr.Invalid("month", "month must be between 1 and 12, got %d", r.Month)
+	}
+	if r.Year < MinRevenueYear || r.Year > MaxRevenueYear {
+		return apperr.Invalid("year", "year must be between %d and %d, got %d", MinRevenueYear, MaxRevenueYear, r.Year)
+	}
+	if r.Amount < 0 {
+		return apperr.Invalid("amount", "amount must not be negative, got %v", r.Amount)
+	}
+	if !currencyCodePattern.MatchString(r.Currency) {
+		return fmt.Errorf("%w %q, use a three letter code such as USD", ErrInvalidCurrency, r.Currency)
+	}
+	return nil
 }
 
-func (c *DbConfig) InitDb() error {
-	sqldb, err := sql.Open(sqliteshim.ShimName, databaseName)
+// Open connects to the database without touching the schema.
+func (c *DbConfig) Open(opts Options) error {
+	sqldb, dialect, err := openSQL(opts)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
-	// defer sqldb.Close()
 
-	c.db = bun.NewDB(sqldb, sqlitedialect.New())
+	c.db = bun.NewDB(sqldb, dialect)
 	c.ctx = context.Background()
+	if err := c.db.PingContext(c.ctx); err != nil {
+		c.db.Close()
+		return fmt.Errorf("failed to connect to %s database: %w", c.Dialect(), err)
+	}
+	log.Printf("connected to %s database", c.Dialect())
+	return nil
+}
 
-	if err := c.createRevenueTable(); err != nil {
-		return fmt.Errorf("failed to create revenue table: %w", err)
+// InitDb opens the database and brings its schema up to date, or checks that
+// it is, depending on opts.AutoMigrate.
+func (c *DbConfig) InitDb(opts Options) error {
+	if err := c.Open(opts); err != nil {
+		return err
 	}
 
-	revenues := generateRevenueData()
-	if err := c.upsertRevenues(revenues); err != nil {
-		log.Printf("failed to upsert revenues: %v", err)
-		return fmt.Errorf("failed to upsert revenues: %w", err)
+	if opts.AutoMigrate {
+		if _, err := c.Migrate(c.ctx); err != nil {
+			return err
+		}
+	} else if err := c.checkMigrations(c.ctx); err != nil {
+		return err
 	}
 
 	log.Println("Database initialized successfully")
-	log.Printf("added revenues: %d", len(revenues))
 
 	return nil
 }
 
-func (c *DbConfig) createRevenueTable() error {
-	// Create the table
-	_, err := c.db.NewCreateTable().
-		Model((*Revenue)(nil)).
-		IfNotExists().
-		Exec(c.ctx)
+func (c *DbConfig) upsertRevenues(revenues []Revenue) error {
+	query := c.db.NewInsert().Model(&revenues)
+	_, err := upsert(query, revenueKeyColumns, "amount", "currency").Exec(c.ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create revenue table: %w", err)
+		return fmt.Errorf("failed to upsert revenues: %w", err)
 	}
+	c.notifyChange(revenueTable)
+	return nil
+}
 
-	// Create unique index for month and year combination
-	_, err = c.db.NewCreateIndex().
-		Model((*Revenue)(nil)).
-		Index("idx_month_year").
-		Column("month", "year").
-		Unique().
-		IfNotExists().
-		Exec(c.ctx)
+// UpsertRevenues inserts the rows, replacing the amount and currency of
+// existing rows with the same month, year and dimensions.
+func (c *DbConfig) UpsertRevenues(revenues []Revenue) error {
+	return c.upsertRevenues(revenues)
+}
+
+// InsertMissingRevenues inserts the rows whose key has no revenue yet and
+// leaves existing rows alone. It returns the number of rows inserted.
+func (c *DbConfig) InsertMissingRevenues(ctx context.Context, revenues []Revenue) (int64, error) {
+	if len(revenues) == 0 {
+		return 0, nil
+	}
+	res, err := c.db.NewInsert().Model(&revenues).Ignore().Exec(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create unique index on month and year: %w", err)
+		return 0, fmt.Errorf("failed to insert revenues: %w", err)
 	}
+	n, _ := res.RowsAffected()
+	if n > 0 {
+		c.notifyChange(revenueTable)
+	}
+	return n, nil
+}
 
+// ReplaceRevenues deletes every row and inserts the given ones in one
+// transaction.
+func (c *DbConfig) ReplaceRevenues(ctx context.Context, revenues []Revenue) error {
+	err := c.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewDelete().Model((*Revenue)(nil)).Where("1 = 1").Exec(ctx); err != nil {
+			return fmt.Errorf("failed to delete revenues: %w", err)
+		}
+		if len(revenues) == 0 {
+			return nil
+		}
+		if _, err := tx.NewInsert().Model(&revenues).Exec(ctx); err != nil {
+			return fmt.Errorf("failed to insert revenues: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	c.notifyChange(revenueTable)
 	return nil
 }
 
-func (c *DbConfig) upsertRevenues(revenues []Revenue) error {
-	_, err := c.db.NewInsert().Model(&revenues).On("CONFLICT (month, year) DO UPDATE SET amount = excluded.amount").Exec(c.ctx)
+// EachRevenue calls fn for every row ordered by year and month, reading the
+// rows one at a time so large tables can be streamed.
+func (c *DbConfig) EachRevenue(ctx context.Context, fn func(Revenue) error) error {
+	rows, err := c.db.NewSelect().Model((*Revenue)(nil)).Order("year", "month", "region", "product_line", "channel").Rows(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to upsert revenues: %w", err)
+		return fmt.Errorf("failed to read revenues: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var revenue Revenue
+		if err := c.db.ScanRow(ctx, rows, &revenue); err != nil {
+			return fmt.Errorf("failed to read revenue: %w", err)
+		}
+		if err := fn(revenue); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CreateRevenue inserts a new row. It returns ErrRevenueExists if a row
+// with the same month, year and dimensions exists.
+func (c *DbConfig) CreateRevenue(ctx context.Context, revenue *Revenue) error {
+	res, err := c.db.NewInsert().Model(revenue).Ignore().Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create revenue: %w", err)
 	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w for %s", ErrRevenueExists, revenue.Key())
+	}
+	c.notifyChange(revenueTable)
 	return nil
 }
 
-func generateRevenueData() []Revenue {
-	return []Revenue{
-		{Month: 1, Year: 2023, Amount: 1000.00},
-		{Month: 2, Year: 2023, Amount: 1500.00},
-		{Month: 3, Year: 2023, Amount: 2000.00},
-		{Month: 4, Year: 2023, Amount: 2500.00},
-		{Month: 5, Year: 2023, Amount: 3000.00},
-		{Month: 6, Year: 2023, Amount: 3500.00},
+// UpdateRevenue sets the amount of an existing row and returns it. An empty
+// currency keeps the current one.
+func (c *DbConfig) UpdateRevenue(ctx context.Context, key RevenueKey, amount float64, currency string) (*Revenue, error) {
+	revenue := &Revenue{}
+	condition, args := key.condition()
+	query := c.db.NewUpdate().
+		Model(revenue).
+		Set("amount = ?", amount).
+		Where(condition, args...)
+	if currency != "" {
+		query.Set("currency = ?", currency)
+	}
+	res, err := query.Exec(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update revenue: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil, fmt.Errorf("%w for %s", ErrRevenueNotFound, key)
+	}
+	c.notifyChange(revenueTable)
+
+	if err := c.db.NewSelect().Model(revenue).Where(condition, args...).Scan(ctx); err != nil {
+		return nil, fmt.Errorf("failed to read updated revenue: %w", err)
+	}
+	return revenue, nil
+}
+
+// DeleteRevenue removes one row.
+func (c *DbConfig) DeleteRevenue(ctx context.Context, key RevenueKey) error {
+	condition, args := key.condition()
+	res, err := c.db.NewDelete().
+		Model((*Revenue)(nil)).
+		Where(condition, args...).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to delete revenue: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w for %s", ErrRevenueNotFound, key)
+	}
+	c.notifyChange(revenueTable)
+	return nil
+}
+
+// OnChange registers a function called after rows of a table are written,
+// e.g. to invalidate cached tool results.
+func (c *DbConfig) OnChange(fn func(table string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, fn)
+}
+
+func (c *DbConfig) notifyChange(table string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, fn := range c.listeners {
+		fn(table)
 	}
 }
 
@@ -106,25 +263,27 @@ func (c *DbConfig) DropRevenueTable() error {
 	return nil
 }
 
-// GetRevenueByMonthYear retrieves revenue for a specific month and year
-func (c *DbConfig) GetRevenueByMonthYear(month, year int) (*Revenue, error) {
-	revenue := &Revenue{}
-	log.Printf("month: %d, year: %d", month, year)
-
-	err := c.db.NewSelect().
-		Model(revenue).
-		Where("month = ? AND year = ?", month, year).
-		Scan(c.ctx)
+// GetRevenueByMonthYear retrieves revenue for a specific month and year,
+// summed over the rows matching the filter. The rows must share a currency.
+func (c *DbConfig) GetRevenueByMonthYear(month, year int, filter RevenueFilter) (*Revenue, error) {
+	log.Printf("month: %d, year: %d, filter: %+v", month, year, filter)
 
+	total, err := c.MonthRevenue(c.ctx, month, year, filter, nil, "")
 	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Printf("no revenue found for month %d and year %d", month, year)
-			return nil, fmt.Errorf("no revenue found for month %d and year %d", month, year)
-		}
+		// ErrRevenueNotFound and the other kinds are kept for the caller
 		log.Printf("failed to get revenue: %v", err)
-		return nil, fmt.Errorf("failed to get revenue: %w", err)
+		return nil, err
 	}
 
+	revenue := &Revenue{
+		Month:       month,
+		Year:        year,
+		Amount:      total.Revenue,
+		Currency:    total.Currency,
+		Region:      filter.Region,
+		ProductLine: filter.ProductLine,
+		Channel:     filter.Channel,
+	}
 	log.Printf("revenue: %+v", revenue)
 	return revenue, nil
 }
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/uptrace/bun/dialect"
+)
+
+// TableSchema describes a table for the model writing queries.
+type TableSchema struct {
+	Name    string         `json:"name"`
+	Columns []ColumnSchema `json:"columns"`
+}
+
+// ColumnSchema is one column of a table.
+type ColumnSchema struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	NotNull bool   `json:"not_null,omitempty"`
+}
+
+func (t TableSchema) String() string {
+	columns := make([]string, 0, len(t.Columns))
+	for _, column := range t.Columns {
+		columns = append(columns, column.Name+" "+column.Type)
+	}
+	return fmt.Sprintf("%s(%s)", t.Name, strings.Join(columns, ", "))
+}
+
+// tableModels are the models of the tables Schema can describe. The
+// migrations register their own snapshots of these tables with bun, so
+// tables are not looked up by name.
+var tableModels = map[string]any{
+	revenueTable:       (*Revenue)(nil),
+	exchangeRatesTable: (*ExchangeRate)(nil),
+	"tool_calls":       (*ToolCall)(nil),
+	"tool_cache":       (*CacheEntry)(nil),
+}
+
+// Schema describes the given tables from their bun models, in the order
+// asked for.
+func (c *DbConfig) Schema(tables []string) ([]TableSchema, error) {
+	schemas := make([]TableSchema, 0, len(tables))
+	for _, name := range tables {
+		model, ok := tableModels[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown table %q", name)
+		}
+		table := c.db.Table(reflect.TypeOf(model).Elem())
+
+		schema := TableSchema{Name: table.Name}
+		for _, field := range table.Fields {
+			sqlType := field.CreateTableSQLType
+			if sqlType == "" {
+				sqlType = field.DiscoveredSQLType
+			}
+			schema.Columns = append(schema.Columns, ColumnSchema{
+				Name:    field.Name,
+				Type:    strings.ToUpper(sqlType),
+				NotNull: field.NotNull || field.IsPK,
+			})
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas, nil
+}
+
+// Dialect names the SQL dialect of the database: sqlite, postgres or mysql.
+func (c *DbConfig) Dialect() string {
+	if c.db.Dialect().Name() == dialect.PG {
+		return DialectPostgres
+	}
+	return c.db.Dialect().Name().String()
+}
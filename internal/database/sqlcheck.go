@@ -0,0 +1,478 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"tempfunctiontools/internal/apperr"
+)
+
+// ErrQueryRejected is returned for queries that fail the read-only checks.
+// The message says why so the query can be fixed.
+var ErrQueryRejected = apperr.New(apperr.ErrInvalid, "query rejected")
+
+// forbiddenWords are keywords and functions that write, change the schema or
+// reach outside the database. They are rejected anywhere in a query. TABLE
+// is rejected as well: "TABLE name" reads a table without FROM.
+var forbiddenWords = []string{
+	"insert", "update", "delete", "merge", "truncate", "into", "table",
+	"create", "drop", "alter", "grant", "revoke",
+	"attach", "detach", "pragma", "vacuum", "reindex",
+	"load_extension", "readfile", "writefile", "edit", "fts3_tokenizer",
+	"pg_read_file", "pg_read_binary_file", "pg_ls_dir", "pg_sleep", "lo_import", "lo_export", "lo_get",
+	"dblink", "dblink_exec",
+	"sleep", "benchmark", "load_file",
+}
+
+// isForbidden reports whether a word is forbidden. Postgres functions such as
+// query_to_xml and table_to_xml run a query or read a table named in a
+// string, so all of them are.
+func isForbidden(word string) bool {
+	return slices.Contains(forbiddenWords, word) || strings.Contains(word, "_to_xml")
+}
+
+// sqlToken is a word, a quoted identifier, a literal or a punctuation mark.
+type sqlToken struct {
+	text   string
+	word   bool // unquoted identifier or keyword, lower-cased
+	quoted bool // quoted identifier
+}
+
+func (t sqlToken) is(word string) bool {
+	return t.word && t.text == word
+}
+
+func (t sqlToken) identifier() bool {
+	return t.word || t.quoted
+}
+
+// sqlLexer holds the lexical rules that differ between dialects. A query the
+// lexer cannot read the way the database would is rejected.
+type sqlLexer struct {
+	// identifierQuotes open a quoted identifier: "name", `name` or [name]
+	identifierQuotes string
+	// dollarQuotes reads Postgres $tag$...$tag$ strings and $1 parameters
+	dollarQuotes bool
+	// noBackslashes rejects backslashes in quotes. Whether they escape the
+	// quote depends on server settings (MySQL sql_mode, Postgres E'' strings
+	// and standard_conforming_strings).
+	noBackslashes bool
+	// mysqlComments reads # comments, only starts -- comments before a space
+	// and rejects /*! comments, whose content MySQL runs.
+	mysqlComments bool
+}
+
+// sqlLexers are the lexers of the supported dialects.
+var sqlLexers = map[string]sqlLexer{
+	DialectSQLite:   {identifierQuotes: "\"`["},
+	DialectPostgres: {identifierQuotes: `"`, dollarQuotes: true, noBackslashes: true},
+	DialectMySQL:    {identifierQuotes: "\"`", noBackslashes: true, mysqlComments: true},
+}
+
+// sqlPunctuation are the operators and punctuation marks read as tokens. Any
+// other character is rejected.
+const sqlPunctuation = "(),.;*+-/%=<>!|&~^:?@#[]"
+
+func isSQLSpace(r rune) bool {
+	return strings.ContainsRune(" \t\n\r\f\v", r)
+}
+
+func isSQLDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isSQLWordRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || isSQLDigit(r)
+}
+
+// tokenizeSQL splits a query of a dialect into tokens, dropping comments and
+// reducing string literals to a placeholder.
+func tokenizeSQL(dialect, query string) ([]sqlToken, error) {
+	lex, ok := sqlLexers[dialect]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported dialect %q", ErrQueryRejected, dialect)
+	}
+
+	var tokens []sqlToken
+	runes := []rune(query)
+	at := func(i int) rune {
+		if i < len(runes) {
+			return runes[i]
+		}
+		return 0
+	}
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case isSQLSpace(r):
+			i++
+		case r == '-' && at(i+1) == '-' && (!lex.mysqlComments || i+2 == len(runes) || isSQLSpace(runes[i+2])),
+			r == '#' && lex.mysqlComments:
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && at(i+1) == '*':
+			j, err := skipComment(runes, i, lex)
+			if err != nil {
+				return nil, err
+			}
+			i = j
+		case r == '\'':
+			j, err := skipQuoted(runes, i, '\'', lex)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, sqlToken{text: "'...'"})
+			i = j
+		case strings.ContainsRune(lex.identifierQuotes, r):
+			closing := r
+			if r == '[' {
+				closing = ']'
+			}
+			j, err := skipQuoted(runes, i, closing, lex)
+			if err != nil {
+				return nil, err
+			}
+			name := strings.ReplaceAll(string(runes[i+1:j-1]), string([]rune{closing, closing}), string(closing))
+			tokens = append(tokens, sqlToken{text: strings.ToLower(name), quoted: true})
+			i = j
+		case r == '$' && lex.dollarQuotes:
+			j, token, err := scanDollar(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token)
+			i = j
+		case r == '_' || unicode.IsLetter(r):
+			j := i
+			for j < len(runes) && isSQLWordRune(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{text: strings.ToLower(string(runes[i:j])), word: true})
+			i = j
+		case isSQLDigit(r):
+			j, err := scanNumber(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, sqlToken{text: string(runes[i:j])})
+			i = j
+		case strings.ContainsRune(sqlPunctuation, r):
+			tokens = append(tokens, sqlToken{text: string(r)})
+			i++
+		default:
+			return nil, fmt.Errorf("%w: unexpected character %q", ErrQueryRejected, r)
+		}
+	}
+	return tokens, nil
+}
+
+// skipComment returns the index after the block comment starting at start.
+// Nested comments are rejected as Postgres nests them and the others do not.
+func skipComment(runes []rune, start int, lex sqlLexer) (int, error) {
+	if lex.mysqlComments && start+2 < len(runes) && runes[start+2] == '!' {
+		return 0, fmt.Errorf("%w: /*! comments are not allowed", ErrQueryRejected)
+	}
+	for i := start + 2; i+1 < len(runes); i++ {
+		switch {
+		case runes[i] == '*' && runes[i+1] == '/':
+			return i + 2, nil
+		case runes[i] == '/' && runes[i+1] == '*':
+			return 0, fmt.Errorf("%w: nested comments are not allowed", ErrQueryRejected)
+		}
+	}
+	return 0, fmt.Errorf("%w: unterminated comment", ErrQueryRejected)
+}
+
+// skipQuoted returns the index after the quote closing the one at start. A
+// doubled quote is an escaped quote.
+func skipQuoted(runes []rune, start int, closing rune, lex sqlLexer) (int, error) {
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] == '\\' && lex.noBackslashes {
+			return 0, fmt.Errorf("%w: backslashes are not allowed in quotes", ErrQueryRejected)
+		}
+		if runes[i] != closing {
+			continue
+		}
+		if i+1 < len(runes) && runes[i+1] == closing && closing != ']' {
+			i++
+			continue
+		}
+		return i + 1, nil
+	}
+	return 0, fmt.Errorf("%w: unterminated quote %c", ErrQueryRejected, runes[start])
+}
+
+// scanDollar reads a Postgres $1 parameter or $tag$ quoted string at start
+// and returns the index after it.
+func scanDollar(runes []rune, start int) (int, sqlToken, error) {
+	i := start + 1
+	if i < len(runes) && isSQLDigit(runes[i]) {
+		for i < len(runes) && isSQLDigit(runes[i]) {
+			i++
+		}
+		return i, sqlToken{text: string(runes[start:i])}, nil
+	}
+
+	for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || i > start+1 && isSQLDigit(runes[i])) {
+		i++
+	}
+	if i >= len(runes) || runes[i] != '$' {
+		return 0, sqlToken{}, fmt.Errorf("%w: unexpected character '$'", ErrQueryRejected)
+	}
+	tag := runes[start : i+1]
+	for j := i + 1; j+len(tag) <= len(runes); j++ {
+		if slices.Equal(runes[j:j+len(tag)], tag) {
+			return j + len(tag), sqlToken{text: "'...'"}, nil
+		}
+	}
+	return 0, sqlToken{}, fmt.Errorf("%w: unterminated quote %s", ErrQueryRejected, string(tag))
+}
+
+// scanNumber reads a number at start and returns the index after it. A
+// letter right after a number is rejected: the dialects disagree on whether
+// 1from is a number and a keyword or a name.
+func scanNumber(runes []rune, start int) (int, error) {
+	i := start
+	digits := func() {
+		for i < len(runes) && isSQLDigit(runes[i]) {
+			i++
+		}
+	}
+	if runes[i] == '0' && i+1 < len(runes) && (runes[i+1] == 'x' || runes[i+1] == 'X') {
+		i += 2
+		for i < len(runes) && strings.ContainsRune("0123456789abcdefABCDEF", runes[i]) {
+			i++
+		}
+	} else {
+		digits()
+		if i < len(runes) && runes[i] == '.' {
+			i++
+			digits()
+		}
+		if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+			j := i + 1
+			if j < len(runes) && (runes[j] == '+' || runes[j] == '-') {
+				j++
+			}
+			if j < len(runes) && isSQLDigit(runes[j]) {
+				i = j
+				digits()
+			}
+		}
+	}
+	if i < len(runes) && isSQLWordRune(runes[i]) {
+		return 0, fmt.Errorf("%w: unexpected %q after a number", ErrQueryRejected, string(runes[start:i+1]))
+	}
+	return i, nil
+}
+
+// readOnlyTokens checks that the query is a single SELECT statement without
+// forbidden keywords and returns its tokens, without a trailing semicolon.
+func readOnlyTokens(dialect, query string) ([]sqlToken, error) {
+	tokens, err := tokenizeSQL(dialect, query)
+	if err != nil {
+		return nil, err
+	}
+	for len(tokens) > 0 && tokens[len(tokens)-1].text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: the query is empty", ErrQueryRejected)
+	}
+
+	if !tokens[0].is("select") && !tokens[0].is("with") {
+		return nil, fmt.Errorf("%w: only SELECT statements are allowed", ErrQueryRejected)
+	}
+	for _, token := range tokens {
+		if token.text == ";" {
+			return nil, fmt.Errorf("%w: only a single statement is allowed", ErrQueryRejected)
+		}
+		if token.word && isForbidden(token.text) {
+			return nil, fmt.Errorf("%w: %s is not allowed in a read-only query", ErrQueryRejected, strings.ToUpper(token.text))
+		}
+	}
+	return tokens, nil
+}
+
+// CheckReadOnlyQuery checks that the query, written for dialect, is a single
+// read-only SELECT that only reads the allowed tables. Names defined in a
+// WITH clause starting the query can be read too. The error wraps
+// ErrQueryRejected and explains the problem.
+func CheckReadOnlyQuery(dialect, query string, allowed []string) error {
+	tokens, err := readOnlyTokens(dialect, query)
+	if err != nil {
+		return err
+	}
+
+	ctes := cteNames(tokens)
+	checkTable := func(i int) error {
+		if i >= len(tokens) {
+			return fmt.Errorf("%w: expected a table name after %s", ErrQueryRejected, strings.ToUpper(tokens[i-1].text))
+		}
+		name := tokens[i]
+		if !name.identifier() {
+			return fmt.Errorf("%w: expected a table name after %s", ErrQueryRejected, strings.ToUpper(tokens[i-1].text))
+		}
+		if i+1 < len(tokens) && tokens[i+1].text == "." {
+			return fmt.Errorf("%w: use table names without a schema, one of %s", ErrQueryRejected, strings.Join(allowed, ", "))
+		}
+		if i+1 < len(tokens) && tokens[i+1].text == "(" {
+			return fmt.Errorf("%w: table functions such as %s are not allowed, read one of the tables %s", ErrQueryRejected, name.text, strings.Join(allowed, ", "))
+		}
+		if visible, ok := ctes[name.text]; ok && i >= visible {
+			return nil
+		}
+		if !slices.Contains(allowed, name.text) {
+			return fmt.Errorf("%w: table %s is not allowed, use one of %s", ErrQueryRejected, name.text, strings.Join(allowed, ", "))
+		}
+		return nil
+	}
+
+	// checkFrom checks the table references from i on: FROM a, (SELECT ...)
+	// b, (c JOIN d). A parenthesis holds a subquery, checked on its own, or
+	// more table references.
+	var checkFrom func(i int) error
+	checkFrom = func(i int) error {
+		for i < len(tokens) {
+			if tokens[i].text == "(" {
+				if !startsSubquery(tokens, i+1) {
+					if err := checkFrom(i + 1); err != nil {
+						return err
+					}
+				}
+				i = closingParen(tokens, i)
+			} else if err := checkTable(i); err != nil {
+				return err
+			}
+			i = skipAlias(tokens, i+1)
+			if i >= len(tokens) || tokens[i].text != "," {
+				return nil
+			}
+			i++
+		}
+		return checkTable(i)
+	}
+
+	// parens records for each open parenthesis whether it holds function
+	// arguments, where FROM is part of the syntax (EXTRACT(x FROM y)), rather
+	// than a subquery
+	var parens []bool
+	for i, token := range tokens {
+		switch {
+		case token.text == "(":
+			call := i > 0 && tokens[i-1].word && !isClauseKeyword(tokens[i-1].text) && !startsSubquery(tokens, i+1)
+			parens = append(parens, call)
+		case token.text == ")":
+			if len(parens) > 0 {
+				parens = parens[:len(parens)-1]
+			}
+		case token.is("from") || token.is("join"):
+			if len(parens) > 0 && parens[len(parens)-1] {
+				continue
+			}
+			if err := checkFrom(i + 1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// startsSubquery reports whether the tokens from i on are a query.
+func startsSubquery(tokens []sqlToken, i int) bool {
+	return i < len(tokens) && (tokens[i].is("select") || tokens[i].is("with") || tokens[i].is("values"))
+}
+
+// closingParen returns the index of the parenthesis closing the one at i.
+func closingParen(tokens []sqlToken, i int) int {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		switch tokens[i].text {
+		case "(":
+			depth++
+		case ")":
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(tokens) - 1
+}
+
+// clauseKeywords may be followed by a parenthesis that is not a call.
+var clauseKeywords = []string{
+	"select", "from", "join", "where", "and", "or", "not", "in", "exists", "as", "on",
+	"union", "all", "intersect", "except", "with", "recursive", "having", "by", "when", "then", "else", "values", "any", "some",
+}
+
+func isClauseKeyword(word string) bool {
+	return slices.Contains(clauseKeywords, word)
+}
+
+// skipAlias skips an optional "[AS] alias" at i.
+func skipAlias(tokens []sqlToken, i int) int {
+	if i < len(tokens) && tokens[i].is("as") {
+		i++
+	}
+	if i < len(tokens) && tokens[i].identifier() && !isClauseKeyword(tokens[i].text) && !slices.Contains(tableReferenceEnds, tokens[i].text) {
+		i++
+	}
+	return i
+}
+
+// tableReferenceEnds are keywords that can follow a table in FROM and so
+// are not an alias.
+var tableReferenceEnds = []string{
+	"left", "right", "inner", "outer", "cross", "full", "natural", "using",
+	"group", "order", "limit", "offset", "window", "fetch", "for",
+}
+
+// cteNames returns the names defined by the WITH clause starting the query,
+// "name AS (" or "name (columns) AS (", with the index of the first token
+// that can read each. Without RECURSIVE a name is only defined after its
+// query, inside it the name is the table. Names defined in subqueries are
+// left out, so reading them is rejected.
+func cteNames(tokens []sqlToken) map[string]int {
+	names := map[string]int{}
+	if !tokens[0].is("with") {
+		return names
+	}
+	i := 1
+	recursive := i < len(tokens) && tokens[i].is("recursive")
+	if recursive {
+		i++
+	}
+	for i < len(tokens) && tokens[i].identifier() {
+		j := i + 1
+		if j < len(tokens) && tokens[j].text == "(" {
+			j = closingParen(tokens, j) + 1
+		}
+		if j >= len(tokens) || !tokens[j].is("as") {
+			break
+		}
+		j++
+		if j < len(tokens) && tokens[j].is("not") {
+			j++
+		}
+		if j < len(tokens) && tokens[j].is("materialized") {
+			j++
+		}
+		if j >= len(tokens) || tokens[j].text != "(" {
+			break
+		}
+		end := closingParen(tokens, j)
+		if recursive {
+			names[tokens[i].text] = j
+		} else {
+			names[tokens[i].text] = end
+		}
+		if end+1 >= len(tokens) || tokens[end+1].text != "," {
+			break
+		}
+		i = end + 2
+	}
+	return names
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+var checkAllowed = []string{"revenue", "exchange_rates"}
+
+var dialects = []string{DialectSQLite, DialectPostgres, DialectMySQL}
+
+func TestCheckReadOnlyQueryAllows(t *testing.T) {
+	queries := []string{
+		"SELECT region, SUM(amount) AS total FROM revenue WHERE year = 2023 GROUP BY region",
+		"select * from revenue;",
+		"SELECT r.amount, e.rate FROM revenue r JOIN exchange_rates e ON e.quote = r.currency",
+		"SELECT * FROM revenue, exchange_rates",
+		"SELECT * FROM (revenue CROSS JOIN exchange_rates)",
+		"SELECT * FROM revenue WHERE amount > (SELECT AVG(amount) FROM revenue)",
+		"SELECT EXTRACT(YEAR FROM date) FROM exchange_rates",
+		"SELECT 'it''s', 1.5e3, 0x1F FROM revenue -- a comment",
+		"SELECT /* a comment */ amount FROM revenue",
+		"WITH totals AS (SELECT year, SUM(amount) AS amount FROM revenue GROUP BY year) SELECT * FROM totals",
+		"WITH RECURSIVE months(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM months WHERE n < 12) SELECT n FROM months",
+		`SELECT "amount" FROM "revenue"`,
+	}
+	for _, dialect := range dialects {
+		for _, query := range queries {
+			if err := CheckReadOnlyQuery(dialect, query, checkAllowed); err != nil {
+				t.Errorf("%s: %q: %v", dialect, query, err)
+			}
+		}
+	}
+
+	if err := CheckReadOnlyQuery(DialectPostgres, "SELECT $tag$it's$tag$, $1 FROM revenue WHERE year = $2", checkAllowed); err != nil {
+		t.Errorf("dollar quotes: %v", err)
+	}
+	if err := CheckReadOnlyQuery(DialectSQLite, "SELECT '\\' FROM revenue", checkAllowed); err != nil {
+		t.Errorf("backslash in a SQLite string: %v", err)
+	}
+	if err := CheckReadOnlyQuery(DialectMySQL, "SELECT `amount` FROM `revenue` # a comment", checkAllowed); err != nil {
+		t.Errorf("backticks: %v", err)
+	}
+}
+
+func TestCheckReadOnlyQueryRejects(t *testing.T) {
+	queries := []string{
+		"",
+		"DELETE FROM revenue",
+		"SELECT * FROM revenue; DROP TABLE revenue",
+		"SELECT * FROM tool_calls",
+		"SELECT * FROM main.revenue",
+		"SELECT * FROM revenue WHERE EXISTS (TABLE tool_calls)",
+		"SELECT * FROM (tool_calls CROSS JOIN revenue)",
+		"SELECT * FROM ((tool_calls))",
+		"SELECT * FROM revenue, (revenue r, tool_calls t)",
+		"SELECT * FROM (WITH tool_calls AS (SELECT 1) SELECT 1) x, tool_calls",
+		"WITH tool_calls AS (SELECT * FROM tool_calls) SELECT * FROM tool_calls",
+		"SELECT query_to_xml('select * from tool_calls', true, true, '') FROM revenue",
+		"SELECT 1from tool_calls",
+		"SELECT 'unterminated FROM revenue",
+		"SELECT /* a /* nested */ ' */ , result FROM tool_calls -- ' FROM revenue",
+		"SELECT amount\u00a0FROM revenue",
+		"SELECT * FROM revenue INTO OUTFILE '/tmp/x'",
+	}
+	for _, dialect := range dialects {
+		for _, query := range queries {
+			if err := CheckReadOnlyQuery(dialect, query, checkAllowed); !errors.Is(err, ErrQueryRejected) {
+				t.Errorf("%s: %q: got %v, want a rejection", dialect, query, err)
+			}
+		}
+	}
+}
+
+// TestCheckReadOnlyQueryQuoting covers queries that hide a table from a
+// lexer that does not know the quoting rules of the dialect.
+func TestCheckReadOnlyQueryQuoting(t *testing.T) {
+	tests := []struct {
+		dialect string
+		query   string
+	}{
+		{DialectPostgres, "SELECT $$'$$ AS a, tool_name, result FROM tool_calls --'"},
+		{DialectPostgres, "SELECT * FROM revenue WHERE EXISTS (TABLE tool_calls)"},
+		{DialectPostgres, "SELECT ARRAY[1][(SELECT count(*) FROM tool_calls)] FROM revenue"},
+		{DialectPostgres, `SELECT E'\'', tool_name FROM tool_calls -- '`},
+		{DialectMySQL, `SELECT '\'', tool_name, result FROM tool_calls -- '`},
+		{DialectMySQL, "SELECT * FROM revenue WHERE EXISTS (TABLE tool_calls)"},
+		{DialectMySQL, "SELECT 1--'\n', result FROM tool_calls -- '"},
+		{DialectMySQL, "SELECT amount FROM revenue # '\n, tool_calls -- '"},
+		{DialectMySQL, "SELECT amount FROM revenue /*!, tool_calls */"},
+		{DialectSQLite, "SELECT $$'$$ AS a, tool_name, result FROM tool_calls --'"},
+		{DialectSQLite, "SELECT * FROM revenue WHERE EXISTS (TABLE tool_calls)"},
+	}
+	for _, test := range tests {
+		if err := CheckReadOnlyQuery(test.dialect, test.query, checkAllowed); !errors.Is(err, ErrQueryRejected) {
+			t.Errorf("%s: %q: got %v, want a rejection", test.dialect, test.query, err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	ToolCallSuccess  = "success"
+	ToolCallError    = "error"
+	ToolCallRejected = "rejected"
+)
+
+// ToolCall is an audit record of one tool execution.
+type ToolCall struct {
+	bun.BaseModel  `bun:"table:tool_calls"`
+	ID             int64     `bun:"id,pk,autoincrement" json:"id"`
+	ConversationID string    `bun:"conversation_id" json:"conversation_id,omitempty"`
+	RequestID      string    `bun:"request_id" json:"request_id,omitempty"`
+	ToolCallID     string    `bun:"tool_call_id" json:"tool_call_id,omitempty"`
+	ToolName       string    `bun:"tool_name,notnull" json:"tool_name"`
+	CalledAs       string    `bun:"called_as" json:"called_as,omitempty"`
+	Arguments      string    `bun:"arguments" json:"arguments"`
+	Result         string    `bun:"result" json:"result,omitempty"`
+	Error          string    `bun:"error" json:"error,omitempty"`
+	Status         string    `bun:"status,notnull" json:"status"`
+	DurationMs     int64     `bun:"duration_ms" json:"duration_ms"`
+	CreatedAt      time.Time `bun:"created_at,notnull" json:"created_at"`
+}
+
+// ToolCallFilter selects audit records. Zero values match everything.
+type ToolCallFilter struct {
+	ToolName       string
+	ConversationID string
+	RequestID      string
+	Status         string
+	From           time.Time
+	To             time.Time
+	Limit          int
+	Offset         int
+}
+
+func (c *DbConfig) InsertToolCall(ctx context.Context, call *ToolCall) error {
+	_, err := c.db.NewInsert().Model(call).Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to insert tool call: %w", err)
+	}
+	return nil
+}
+
+// ListToolCalls returns matching audit records, newest first.
+func (c *DbConfig) ListToolCalls(ctx context.Context, filter ToolCallFilter) ([]ToolCall, error) {
+	calls := []ToolCall{}
+
+	query := c.db.NewSelect().Model(&calls).Order("created_at DESC", "id DESC")
+	if filter.ToolName != "" {
+		query.Where("tool_name = ?", filter.ToolName)
+	}
+	if filter.ConversationID != "" {
+		query.Where("conversation_id = ?", filter.ConversationID)
+	}
+	if filter.RequestID != "" {
+		query.Where("request_id = ?", filter.RequestID)
+	}
+	if filter.Status != "" {
+		query.Where("status = ?", filter.Status)
+	}
+	if !filter.From.IsZero() {
+		query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query.Where("created_at < ?", filter.To)
+	}
+	if filter.Limit > 0 {
+		query.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query.Offset(filter.Offset)
+	}
+
+	if err := query.Scan(ctx); err != nil {
+		return nil, fmt.Errorf("failed to list tool calls: %w", err)
+	}
+	return calls, nil
+}
@@ -0,0 +1,55 @@
+package declarative
+
+import (
+	"log"
+
+	"tempfunctiontools/internal/config"
+	"tempfunctiontools/models"
+)
+
+// RegisterAliases registers the aliases declared in the config file. Invalid
+// declarations are logged and skipped.
+func RegisterAliases(agent *models.Agent, specs []config.Alias) {
+	for _, spec := range specs {
+		if spec.Name == "" || spec.Target == "" {
+			log.Printf("declarative: skipping alias %q: name and target are required", spec.Name)
+			continue
+		}
+
+		alias := models.Alias{
+			Name:       spec.Name,
+			Target:     spec.Target,
+			Version:    spec.Version,
+			Deprecated: spec.Deprecated,
+			Note:       spec.Note,
+		}
+		if len(spec.Rename) > 0 || len(spec.Defaults) > 0 {
+			alias.Adapt = adapter(spec.Rename, spec.Defaults)
+		}
+
+		if err := agent.Tools.RegisterAlias(alias); err != nil {
+			log.Printf("declarative: skipping alias %s: %v", spec.Name, err)
+			continue
+		}
+		log.Printf("declarative: registered alias %s for %s", spec.Name, spec.Target)
+	}
+}
+
+// adapter renames arguments and fills in defaults for missing ones.
+func adapter(rename map[string]string, defaults map[string]any) func(map[string]any) (map[string]any, error) {
+	return func(args map[string]any) (map[string]any, error) {
+		adapted := make(map[string]any, len(args)+len(defaults))
+		for key, value := range args {
+			if to, ok := rename[key]; ok {
+				key = to
+			}
+			adapted[key] = value
+		}
+		for key, value := range defaults {
+			if _, ok := adapted[key]; !ok {
+				adapted[key] = value
+			}
+		}
+		return adapted, nil
+	}
+}
@@ -0,0 +1,367 @@
+package declarative
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+
+	"tempfunctiontools/internal/config"
+	"tempfunctiontools/models"
+)
+
+// inputStep is the reserved step id holding the composite's own arguments.
+const inputStep = "input"
+
+// pathPlaceholder matches {$...} JSON path placeholders inside strings.
+var pathPlaceholder = regexp.MustCompile(`\{(\$[^{}]*)\}`)
+
+// composite runs a DAG of tool calls. Steps are grouped into levels; every
+// step of a level only depends on earlier levels, so a level runs
+// concurrently.
+type composite struct {
+	agent  *models.Agent
+	name   string
+	levels [][]config.CompositeStep
+	result any
+}
+
+func newComposite(agent *models.Agent, name string, spec config.CompositeToolSpec) (*composite, error) {
+	if len(spec.Steps) == 0 {
+		return nil, fmt.Errorf("composite tool needs at least one step")
+	}
+
+	steps := make(map[string]config.CompositeStep, len(spec.Steps))
+	for _, step := range spec.Steps {
+		switch {
+		case step.ID == "":
+			return nil, fmt.Errorf("composite step needs an id")
+		case step.ID == inputStep:
+			return nil, fmt.Errorf("composite step id %q is reserved", inputStep)
+		case step.Tool == "":
+			return nil, fmt.Errorf("composite step %s needs a tool", step.ID)
+		case step.Tool == name:
+			return nil, fmt.Errorf("composite step %s calls the composite itself", step.ID)
+		}
+		if _, exists := steps[step.ID]; exists {
+			return nil, fmt.Errorf("duplicate composite step %s", step.ID)
+		}
+		steps[step.ID] = step
+	}
+
+	deps := make(map[string][]string, len(spec.Steps))
+	for _, step := range spec.Steps {
+		refs, err := references(step.Args)
+		if err != nil {
+			return nil, fmt.Errorf("composite step %s: %w", step.ID, err)
+		}
+		for _, dep := range append(refs, step.After...) {
+			if dep == inputStep {
+				continue
+			}
+			if _, exists := steps[dep]; !exists {
+				return nil, fmt.Errorf("composite step %s depends on unknown step %s", step.ID, dep)
+			}
+			deps[step.ID] = append(deps[step.ID], dep)
+		}
+	}
+	if _, err := references(spec.Result); err != nil {
+		return nil, fmt.Errorf("composite result: %w", err)
+	}
+
+	levels, err := levelize(spec.Steps, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &composite{agent: agent, name: name, levels: levels, result: spec.Result}, nil
+}
+
+// compositeCycles returns the composites whose steps lead back to
+// themselves, directly or through other composites, with the call path.
+func compositeCycles(specs []config.ToolSpec) map[string][]string {
+	calls := make(map[string][]string)
+	for _, spec := range specs {
+		if spec.Composite == nil {
+			continue
+		}
+		for _, step := range spec.Composite.Steps {
+			calls[spec.Name] = append(calls[spec.Name], step.Tool)
+		}
+	}
+
+	cycles := make(map[string][]string)
+	for name := range calls {
+		if path := cyclePath(calls, name); path != nil {
+			cycles[name] = path
+		}
+	}
+	return cycles
+}
+
+// cyclePath returns a call path from name back to name, or nil.
+func cyclePath(calls map[string][]string, name string) []string {
+	seen := make(map[string]bool)
+	var walk func(tool string, path []string) []string
+	walk = func(tool string, path []string) []string {
+		path = append(slices.Clip(path), tool)
+		if tool == name && len(path) > 1 {
+			return path
+		}
+		if seen[tool] {
+			return nil
+		}
+		seen[tool] = true
+		for _, next := range calls[tool] {
+			if found := walk(next, path); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	return walk(name, nil)
+}
+
+// levelize orders the steps into levels, keeping the declared order within
+// a level. It fails on dependency cycles.
+func levelize(steps []config.CompositeStep, deps map[string][]string) ([][]config.CompositeStep, error) {
+	done := make(map[string]bool, len(steps))
+	var levels [][]config.CompositeStep
+
+	for len(done) < len(steps) {
+		var level []config.CompositeStep
+		for _, step := range steps {
+			if done[step.ID] {
+				continue
+			}
+			ready := true
+			for _, dep := range deps[step.ID] {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				level = append(level, step)
+			}
+		}
+		if len(level) == 0 {
+			return nil, fmt.Errorf("composite steps have a dependency cycle")
+		}
+		for _, step := range level {
+			done[step.ID] = true
+		}
+		levels = append(levels, level)
+	}
+
+	return levels, nil
+}
+
+// references returns the step ids a mapping refers to through JSON paths.
+func references(value any) ([]string, error) {
+	var refs []string
+	var walk func(v any) error
+	walk = func(v any) error {
+		switch node := v.(type) {
+		case string:
+			for _, path := range paths(node) {
+				steps, err := parseJSONPath(path)
+				if err != nil {
+					return err
+				}
+				if len(steps) == 0 || steps[0].isIndex || steps[0].wildcard {
+					return fmt.Errorf("json path %s must start with a step id", path)
+				}
+				refs = append(refs, steps[0].key)
+			}
+		case map[string]any:
+			for _, item := range node {
+				if err := walk(item); err != nil {
+					return err
+				}
+			}
+		case []any:
+			for _, item := range node {
+				if err := walk(item); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return refs, walk(value)
+}
+
+// paths returns the JSON paths in a mapping string: the whole string when it
+// is a path, otherwise its {$...} placeholders.
+func paths(s string) []string {
+	if strings.HasPrefix(s, "$") {
+		return []string{s}
+	}
+	var found []string
+	for _, match := range pathPlaceholder.FindAllStringSubmatch(s, -1) {
+		found = append(found, match[1])
+	}
+	return found
+}
+
+// resolve builds a value from a mapping against the outputs seen so far.
+func resolve(value any, outputs map[string]any) (any, error) {
+	switch node := value.(type) {
+	case string:
+		if strings.HasPrefix(node, "$") {
+			return evalJSONPath(node, outputs)
+		}
+		var err error
+		expanded := pathPlaceholder.ReplaceAllStringFunc(node, func(match string) string {
+			v, evalErr := evalJSONPath(match[1:len(match)-1], outputs)
+			if evalErr != nil {
+				err = evalErr
+				return ""
+			}
+			if v == nil {
+				return ""
+			}
+			return fmt.Sprint(v)
+		})
+		return expanded, err
+	case map[string]any:
+		resolved := make(map[string]any, len(node))
+		for key, item := range node {
+			v, err := resolve(item, outputs)
+			if err != nil {
+				return nil, err
+			}
+			resolved[key] = v
+		}
+		return resolved, nil
+	case []any:
+		resolved := make([]any, 0, len(node))
+		for _, item := range node {
+			v, err := resolve(item, outputs)
+			if err != nil {
+				return nil, err
+			}
+			resolved = append(resolved, v)
+		}
+		return resolved, nil
+	default:
+		return value, nil
+	}
+}
+
+// stepResult is the outcome of one step of a level.
+type stepResult struct {
+	output any
+	err    error
+}
+
+// runningKey holds the names of the composites running in a context.
+type runningKey struct{}
+
+func (c *composite) execute(ctx context.Context, args map[string]any) (any, error) {
+	// registration rejects cycles between composites; this catches the ones
+	// closed later, e.g. through an alias
+	running, _ := ctx.Value(runningKey{}).([]string)
+	if slices.Contains(running, c.name) {
+		return nil, fmt.Errorf("composite %s calls itself through %s", c.name, strings.Join(running, " -> "))
+	}
+	ctx = context.WithValue(ctx, runningKey{}, append(slices.Clip(running), c.name))
+
+	input, err := normalize(args)
+	if err != nil {
+		return nil, err
+	}
+	outputs := map[string]any{inputStep: input}
+
+	for _, level := range c.levels {
+		results := make([]stepResult, len(level))
+
+		var wg sync.WaitGroup
+		for i, step := range level {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// a panicking tool fails its step; the goroutine is outside
+				// any recovery of the caller
+				defer func() {
+					if r := recover(); r != nil {
+						log.Printf("composite %s: step %s panicked: %v\n%s", c.name, step.ID, r, debug.Stack())
+						results[i] = stepResult{err: fmt.Errorf("tool %s panicked: %v", step.Tool, r)}
+					}
+				}()
+				output, err := c.runStep(ctx, step, outputs)
+				results[i] = stepResult{output: output, err: err}
+			}()
+		}
+		wg.Wait()
+
+		for i, step := range level {
+			if results[i].err != nil {
+				return nil, fmt.Errorf("step %s (%s): %w", step.ID, step.Tool, results[i].err)
+			}
+			outputs[step.ID] = results[i].output
+		}
+	}
+
+	if c.result == nil {
+		delete(outputs, inputStep)
+		return outputs, nil
+	}
+	return resolve(c.result, outputs)
+}
+
+// runStep calls the step's tool through CallTool, so a step is audited,
+// cached and refused when disabled like any other call. outputs is only read
+// here; it is updated between levels.
+func (c *composite) runStep(ctx context.Context, step config.CompositeStep, outputs map[string]any) (any, error) {
+	tool, err := c.agent.Tools.Get(step.Tool)
+	if err != nil {
+		return nil, err
+	}
+	// a held tool only runs when the composite itself was approved
+	approved := models.Approved(ctx)
+	if tool.RequiresApproval && !approved {
+		return nil, fmt.Errorf("tool %s requires approval, set requires_approval on %s to call it from a composite", step.Tool, c.name)
+	}
+
+	resolved, err := resolve(step.Args, outputs)
+	if err != nil {
+		return nil, err
+	}
+	stepArgs, _ := resolved.(map[string]any)
+	if stepArgs == nil {
+		stepArgs = map[string]any{}
+	}
+
+	log.Printf("declarative: %s step %s calling %s with %v", c.name, step.ID, step.Tool, stepArgs)
+
+	call, err := models.NewToolCall(c.name+"/"+step.ID, step.Tool, stepArgs)
+	if err != nil {
+		return nil, err
+	}
+	output, err := c.agent.CallTool(ctx, call, approved)
+	if err != nil {
+		return nil, err
+	}
+	return normalize(output)
+}
+
+// normalize round-trips a value through JSON so that structs returned by Go
+// tools can be addressed by JSON paths.
+func normalize(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode step output: %w", err)
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode step output: %w", err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,117 @@
+package declarative
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"tempfunctiontools/internal/apperr"
+	"tempfunctiontools/internal/config"
+)
+
+const (
+	defaultExecTimeout   = 30 * time.Second
+	defaultMaxExecOutput = 1 << 20
+	maxStderr            = 4 * 1024
+)
+
+var errOutputTooLarge = errors.New("output too large")
+
+// cappedBuffer collects up to max bytes. Unless discard is set, writes beyond
+// that fail, which makes the process see a broken pipe instead of filling
+// memory; with discard the rest is dropped and the process carries on.
+type cappedBuffer struct {
+	buf      bytes.Buffer
+	max      int
+	discard  bool
+	exceeded bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.buf.Len()+len(p) > b.max {
+		b.buf.Write(p[:b.max-b.buf.Len()])
+		b.exceeded = true
+		if b.discard {
+			return len(p), nil
+		}
+		return 0, errOutputTooLarge
+	}
+	return b.buf.Write(p)
+}
+
+// executeCommand runs the configured executable with the JSON arguments on
+// stdin and decodes its stdout as the result.
+func executeCommand(ctx context.Context, spec config.ExecToolSpec, args map[string]any) (any, error) {
+	timeout := spec.Timeout
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	maxOutput := spec.MaxOutputBytes
+	if maxOutput <= 0 {
+		maxOutput = defaultMaxExecOutput
+	}
+
+	input, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode arguments: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, spec.Command, spec.Args...)
+	cmd.Dir = spec.Dir
+	cmd.Env = allowedEnv(spec.Env)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.WaitDelay = time.Second
+
+	stdout := &cappedBuffer{max: maxOutput}
+	// a noisy stderr only loses its tail, it does not fail the tool; the
+	// error message says so
+	stderr := &cappedBuffer{max: maxStderr, discard: true}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	log.Printf("declarative: running %s", spec.Command)
+
+	err = cmd.Run()
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return nil, apperr.Errorf(context.DeadlineExceeded, "%s timed out after %s", spec.Command, timeout)
+	case stdout.exceeded:
+		return nil, apperr.Errorf(apperr.ErrTooLarge, "%s wrote more than %d bytes", spec.Command, maxOutput)
+	case err != nil:
+		msg := strings.TrimSpace(stderr.buf.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		if stderr.exceeded {
+			msg += fmt.Sprintf(" ... [stderr truncated after %d bytes]", maxStderr)
+		}
+		return nil, fmt.Errorf("%s failed: %s", spec.Command, msg)
+	}
+
+	var result any
+	if err := json.Unmarshal(stdout.buf.Bytes(), &result); err != nil {
+		return nil, fmt.Errorf("%s did not write a JSON result: %w", spec.Command, err)
+	}
+	return result, nil
+}
+
+// allowedEnv returns the allow-listed variables of the service environment.
+func allowedEnv(names []string) []string {
+	env := []string{}
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
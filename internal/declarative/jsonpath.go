@@ -0,0 +1,143 @@
+package declarative
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// evalJSONPath evaluates a small subset of JSONPath against decoded JSON:
+// $ for the root, .name or ['name'] for object keys, [n] for array indexes
+// and [*] or .* for every element.
+func evalJSONPath(path string, value any) (any, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	current := []any{value}
+	wildcard := false
+	for _, step := range steps {
+		var next []any
+		for _, v := range current {
+			matched, err := step.apply(v)
+			if err != nil {
+				return nil, fmt.Errorf("json path %s: %w", path, err)
+			}
+			next = append(next, matched...)
+		}
+		if step.wildcard {
+			wildcard = true
+		}
+		current = next
+	}
+
+	if wildcard {
+		return current, nil
+	}
+	if len(current) == 0 {
+		return nil, nil
+	}
+	return current[0], nil
+}
+
+type pathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func (s pathStep) apply(v any) ([]any, error) {
+	switch {
+	case s.wildcard:
+		switch node := v.(type) {
+		case []any:
+			return node, nil
+		case map[string]any:
+			values := make([]any, 0, len(node))
+			for _, value := range node {
+				values = append(values, value)
+			}
+			return values, nil
+		}
+		return nil, nil
+	case s.isIndex:
+		arr, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("cannot index non-array with [%d]", s.index)
+		}
+		index := s.index
+		if index < 0 {
+			index += len(arr)
+		}
+		if index < 0 || index >= len(arr) {
+			return nil, nil
+		}
+		return []any{arr[index]}, nil
+	default:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("cannot select key %q of non-object", s.key)
+		}
+		value, ok := obj[s.key]
+		if !ok {
+			return nil, nil
+		}
+		return []any{value}, nil
+	}
+}
+
+func parseJSONPath(path string) ([]pathStep, error) {
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("json path %q must start with $", path)
+	}
+	rest := path[1:]
+
+	var steps []pathStep
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			rest = rest[end:]
+			if key == "" {
+				return nil, fmt.Errorf("json path %q has an empty key", path)
+			}
+			if key == "*" {
+				steps = append(steps, pathStep{wildcard: true})
+			} else {
+				steps = append(steps, pathStep{key: key})
+			}
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("json path %q has an unterminated [", path)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+
+			switch {
+			case inner == "*":
+				steps = append(steps, pathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"'):
+				steps = append(steps, pathStep{key: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("json path %q has an invalid index %q", path, inner)
+				}
+				steps = append(steps, pathStep{index: index, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("json path %q is invalid near %q", path, rest)
+		}
+	}
+
+	return steps, nil
+}
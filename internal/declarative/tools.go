@@ -0,0 +1,294 @@
+package declarative
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"tempfunctiontools/internal/apperr"
+	"tempfunctiontools/internal/config"
+	"tempfunctiontools/models"
+)
+
+const (
+	requestTimeout  = 30 * time.Second
+	queryTimeout    = 10 * time.Second
+	maxResponseSize = 1 << 20
+	defaultMaxRows  = 100
+)
+
+var (
+	placeholder    = regexp.MustCompile(`\{([a-zA-Z0-9_]+)\}`)
+	envPlaceholder = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+)
+
+// RegisterTools builds the declared tools and registers them into
+// agent.Tools next to the Go-coded ones. Invalid declarations are logged and
+// skipped.
+func RegisterTools(agent *models.Agent, specs []config.ToolSpec) {
+	cycles := compositeCycles(specs)
+	for _, spec := range specs {
+		if path, cyclic := cycles[spec.Name]; cyclic {
+			log.Printf("declarative: skipping tool %s: composite steps call it again through %s", spec.Name, strings.Join(path, " -> "))
+			continue
+		}
+
+		tool, err := NewTool(agent, spec)
+		if err != nil {
+			log.Printf("declarative: skipping tool %s: %v", spec.Name, err)
+			continue
+		}
+
+		if !agent.Tools.Register(tool) {
+			log.Printf("declarative: tool %s version %d already registered, skipping", spec.Name, spec.Version)
+		}
+	}
+}
+
+// NewTool builds a tool from its declaration.
+func NewTool(agent *models.Agent, spec config.ToolSpec) (models.Tool, error) {
+	if spec.Name == "" {
+		return models.Tool{}, fmt.Errorf("tool name is required")
+	}
+
+	params, err := parameters(spec.Parameters)
+	if err != nil {
+		return models.Tool{}, err
+	}
+
+	tool := models.Tool{
+		Type: "function",
+		Function: &models.Function{
+			Name:        spec.Name,
+			Description: spec.Description,
+			Parameters:  params,
+		},
+		RequiresApproval: spec.RequiresApproval,
+		Version:          spec.Version,
+	}
+	for _, example := range spec.Examples {
+		converted := models.Example{Query: example.Query, Note: example.Note}
+		for _, call := range example.Calls {
+			converted.Calls = append(converted.Calls, models.ExampleCall{Name: call.Name, Arguments: call.Arguments})
+		}
+		tool.Function.Examples = append(tool.Function.Examples, converted)
+	}
+
+	kinds := 0
+	for _, declared := range []bool{spec.HTTP != nil, spec.SQL != nil, spec.Exec != nil, spec.Composite != nil} {
+		if declared {
+			kinds++
+		}
+	}
+	if kinds > 1 {
+		return models.Tool{}, fmt.Errorf("tool declares more than one of http, sql, exec and composite")
+	}
+
+	switch {
+	case spec.HTTP != nil:
+		if spec.HTTP.URL == "" {
+			return models.Tool{}, fmt.Errorf("http tool needs a url")
+		}
+		if spec.HTTP.ResultPath != "" {
+			if _, err := parseJSONPath(spec.HTTP.ResultPath); err != nil {
+				return models.Tool{}, err
+			}
+		}
+		httpSpec := *spec.HTTP
+		httpSpec.Headers = expandEnv(spec.HTTP.Headers)
+		client := &http.Client{Timeout: requestTimeout}
+		tool.Execute = func(ctx context.Context, args map[string]any) (any, error) {
+			return executeHTTP(ctx, client, httpSpec, args)
+		}
+	case spec.SQL != nil:
+		if spec.SQL.Query == "" {
+			return models.Tool{}, fmt.Errorf("sql tool needs a query")
+		}
+		sqlSpec := *spec.SQL
+		tool.Execute = func(ctx context.Context, args map[string]any) (any, error) {
+			return executeSQL(ctx, agent, sqlSpec, args)
+		}
+	case spec.Exec != nil:
+		if spec.Exec.Command == "" {
+			return models.Tool{}, fmt.Errorf("exec tool needs a command")
+		}
+		execSpec := *spec.Exec
+		tool.Execute = func(ctx context.Context, args map[string]any) (any, error) {
+			return executeCommand(ctx, execSpec, args)
+		}
+	case spec.Composite != nil:
+		composite, err := newComposite(agent, spec.Name, *spec.Composite)
+		if err != nil {
+			return models.Tool{}, err
+		}
+		tool.Execute = composite.execute
+	default:
+		return models.Tool{}, fmt.Errorf("tool declares none of http, sql, exec and composite")
+	}
+
+	return tool, nil
+}
+
+func parameters(raw map[string]any) (*models.Parameters, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	schema := &models.Schema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	return schema.ToParameters(), nil
+}
+
+// expand replaces {name} placeholders with the matching arguments, passing
+// each value through escape. A placeholder without an argument is an
+// apperr.ErrInvalid; the environment is never read here, since the model
+// chooses which arguments it sends.
+func expand(template string, args map[string]any, escape func(string) string) (string, error) {
+	var missing string
+	expanded := placeholder.ReplaceAllStringFunc(template, func(match string) string {
+		name := match[1 : len(match)-1]
+		value, ok := args[name]
+		if !ok {
+			if missing == "" {
+				missing = name
+			}
+			return match
+		}
+		return escape(fmt.Sprint(value))
+	})
+	if missing != "" {
+		return "", apperr.Invalid(missing, "missing argument %s", missing)
+	}
+	return expanded, nil
+}
+
+// expandEnv replaces ${NAME} in configured header values with the
+// environment variable, so secrets can stay out of the config file.
+func expandEnv(headers map[string]string) map[string]string {
+	expanded := make(map[string]string, len(headers))
+	for k, v := range headers {
+		expanded[k] = envPlaceholder.ReplaceAllStringFunc(v, func(match string) string {
+			return os.Getenv(match[2 : len(match)-1])
+		})
+	}
+	return expanded
+}
+
+func queryEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func noEscape(s string) string {
+	return s
+}
+
+func jsonEscape(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data[1 : len(data)-1])
+}
+
+func executeHTTP(ctx context.Context, client *http.Client, spec config.HTTPToolSpec, args map[string]any) (any, error) {
+	method := spec.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if spec.Body != "" {
+		expanded, err := expand(spec.Body, args, jsonEscape)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(expanded)
+	}
+
+	target, err := expand(spec.URL, args, queryEscape)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), target, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range spec.Headers {
+		value, err := expand(v, args, noEscape)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(k, value)
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	log.Printf("declarative: %s %s", req.Method, target)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("error calling API: %v", err)
+		return nil, apperr.Upstream(req.URL.Host, 0, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		return nil, apperr.Upstream(req.URL.Host, resp.StatusCode, fmt.Errorf("request returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data))))
+	}
+
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		if spec.ResultPath != "" {
+			return nil, fmt.Errorf("response is not JSON, cannot apply %s", spec.ResultPath)
+		}
+		return string(data), nil
+	}
+
+	if spec.ResultPath == "" {
+		return decoded, nil
+	}
+	return evalJSONPath(spec.ResultPath, decoded)
+}
+
+func executeSQL(ctx context.Context, agent *models.Agent, spec config.SQLToolSpec, args map[string]any) (any, error) {
+	if agent.Db == nil {
+		return nil, fmt.Errorf("database is not configured")
+	}
+
+	queryArgs := make([]any, len(spec.Args))
+	for i, name := range spec.Args {
+		value, ok := args[name]
+		if !ok {
+			return nil, apperr.Invalid(name, "missing argument %s", name)
+		}
+		queryArgs[i] = value
+	}
+
+	maxRows := spec.MaxRows
+	if maxRows <= 0 {
+		maxRows = defaultMaxRows
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	return agent.Db.QueryReadOnly(ctx, spec.Query, maxRows, queryArgs...)
+}
@@ -5,9 +5,31 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
+	"tempfunctiontools/internal/apperr"
+	"tempfunctiontools/internal/resilience"
 	"time"
 )
 
+// locationCache reuses the ip-api.com lookup, since the server's location
+// rarely changes. Only the location is cached, never the date and time.
+var locationCache struct {
+	sync.Mutex
+	ttl       time.Duration
+	location  Location
+	expiresAt time.Time
+}
+
+// ConfigureLocationCache sets how long a looked up location is reused. Zero
+// or less looks it up on every call.
+func ConfigureLocationCache(ttl time.Duration) {
+	locationCache.Lock()
+	defer locationCache.Unlock()
+
+	locationCache.ttl = ttl
+	locationCache.expiresAt = time.Time{}
+}
+
 type DateTime struct {
 	Date     string   `json:"date"`
 	Time     string   `json:"time"`
@@ -34,8 +56,10 @@ type LocationData struct {
 	Timezone    string  `json:"timezone"`
 }
 
-// GetCurrentDateTime returns the current date and time
-func GetCurrentDateTimeLocation() DateTime {
+// GetCurrentDateTimeLocation returns the current date, time and location. A
+// failed location lookup fails the call, e.g. with apperr.ErrUnavailable when
+// ip-api.com is rate limited, rather than returning an empty location.
+func GetCurrentDateTimeLocation() (DateTime, error) {
 	log.Println("Getting current date and time")
 	// load the current timezone
 	dt := time.Now()
@@ -55,18 +79,26 @@ func GetCurrentDateTimeLocation() DateTime {
 	loc, err := GetLocationInformation()
 	if err != nil {
 		log.Printf("error getting location: %v", err)
-		return result
+		return result, err
 	}
 
 	result.Location = loc
 
 	// return the current date and time
-	return result
+	return result, nil
 }
 
 // get location information
 func GetLocationInformation() (Location, error) {
 	log.Println("Getting location information")
+
+	locationCache.Lock()
+	defer locationCache.Unlock()
+
+	if time.Now().Before(locationCache.expiresAt) {
+		return locationCache.location, nil
+	}
+
 	// get the current location
 	loc, err := GetCurrentLocation()
 	if err != nil {
@@ -74,13 +106,18 @@ func GetLocationInformation() (Location, error) {
 		return Location{}, err
 	}
 
-	return Location{
+	location := Location{
 		Latitude:  loc.Latitude,
 		Longitude: loc.Longitude,
 		Country:   loc.Country,
 		City:      loc.City,
 		Timezone:  loc.Timezone,
-	}, nil
+	}
+	if locationCache.ttl > 0 {
+		locationCache.location = location
+		locationCache.expiresAt = time.Now().Add(locationCache.ttl)
+	}
+	return location, nil
 }
 
 func GetCurrentLocation() (LocationData, error) {
@@ -89,7 +126,13 @@ func GetCurrentLocation() (LocationData, error) {
 	result := LocationData{}
 	api := "http://ip-api.com/json"
 
-	resp, err := http.Get(api)
+	req, err := http.NewRequest("GET", api, nil)
+	if err != nil {
+		log.Printf("error creating request: %v", err)
+		return result, err
+	}
+
+	resp, err := resilience.Get(resilience.IPAPI).Do(http.DefaultClient, req)
 	if err != nil {
 		log.Printf("error calling API: %v", err)
 		return result, err
@@ -100,14 +143,14 @@ func GetCurrentLocation() (LocationData, error) {
 		log.Printf("error decoding response: %v", err)
 		// print the response
 		log.Printf("response: %+v", resp)
-		return result, err
+		return result, apperr.Upstream(resilience.IPAPI, resp.StatusCode, fmt.Errorf("failed to decode location: %w", err))
 	}
 
 	log.Printf("result: %+v", result)
 
 	if result.Status != "success" {
 		log.Printf("error getting location: %v", result.Status)
-		return result, fmt.Errorf("error getting location: %v", result.Status)
+		return result, apperr.Upstream(resilience.IPAPI, resp.StatusCode, fmt.Errorf("error getting location: %v", result.Status))
 	}
 
 	return result, nil
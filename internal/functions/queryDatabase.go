@@ -0,0 +1,138 @@
+package functions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"tempfunctiontools/internal/apperr"
+	"tempfunctiontools/internal/config"
+	"tempfunctiontools/internal/database"
+	"tempfunctiontools/models"
+)
+
+// tableNotes explain columns whose meaning the schema does not show.
+var tableNotes = map[string]string{
+	"revenue":        "one row per month, year, region, product_line and channel; empty dimensions mean not segmented; amount is in the row's currency",
+	"exchange_rates": "one unit of base is worth rate units of quote on date (YYYY-MM-DD)",
+}
+
+// QueryResult is what query_database returns to the model.
+type QueryResult struct {
+	Columns   []string `json:"columns"`
+	Rows      [][]any  `json:"rows"`
+	RowCount  int      `json:"row_count"`
+	Truncated bool     `json:"truncated,omitempty"`
+	Note      string   `json:"note,omitempty"`
+}
+
+// QueryDatabaseTool lets the model answer questions the other tools do not
+// cover with its own SELECT over the allowed tables, whose schema is part of
+// the description.
+func QueryDatabaseTool(agent *models.Agent, cfg config.QueryDatabase) (models.Tool, error) {
+	schemas, err := agent.Db.Schema(cfg.Tables)
+	if err != nil {
+		return models.Tool{}, err
+	}
+
+	var description strings.Builder
+	fmt.Fprintf(&description, "Run one read-only SQL SELECT against the application database (%s dialect) and get the columns and rows back. "+
+		"Use it for questions the other tools cannot answer. Only these tables can be read, at most %d rows are returned and queries time out after %s. "+
+		"Rejected queries come back with the reason so they can be fixed.\nTables:", agent.Db.Dialect(), cfg.MaxRows, cfg.Timeout)
+	for _, schema := range schemas {
+		fmt.Fprintf(&description, "\n%s", schema)
+		if note, ok := tableNotes[schema.Name]; ok {
+			fmt.Fprintf(&description, " -- %s", note)
+		}
+	}
+
+	return models.Tool{
+		Type: "function",
+		Function: &models.Function{
+			Name:        "query_database",
+			Description: description.String(),
+			Parameters: &models.Parameters{
+				Type: "object",
+				Properties: map[string]*models.Parameter{
+					"query": {
+						Type:        "string",
+						Description: "A single SELECT statement, e.g. SELECT region, SUM(amount) AS total FROM revenue WHERE year = 2023 GROUP BY region",
+					},
+				},
+				Required: []string{"query"},
+			},
+			Examples: []models.Example{
+				{
+					Query: "Which channel had the most revenue in 2023?",
+					Calls: []models.ExampleCall{{Arguments: map[string]any{
+						"query": "SELECT channel, SUM(amount) AS total FROM revenue WHERE year = 2023 GROUP BY channel ORDER BY total DESC LIMIT 1",
+					}}},
+					Note: "prefer the revenue tools when they answer the question, they convert currencies",
+				},
+			},
+		},
+		Execute: func(ctx context.Context, args map[string]any) (any, error) {
+			query, _ := args["query"].(string)
+			return QueryDatabase(query, cfg, agent.Db)
+		},
+	}, nil
+}
+
+// QueryDatabase checks the query against the limits and runs it.
+func QueryDatabase(query string, cfg config.QueryDatabase, db *database.DbConfig) (*QueryResult, error) {
+	log.Printf("query_database: %s", query)
+
+	if err := database.CheckReadOnlyQuery(db.Dialect(), query, cfg.Tables); err != nil {
+		log.Printf("query_database: %v", err)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	result, err := db.QueryReadOnly(ctx, query, cfg.MaxRows)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, apperr.Errorf(context.DeadlineExceeded, "query timed out after %s, narrow it down or aggregate in SQL", cfg.Timeout)
+		}
+		return nil, err
+	}
+
+	out := &QueryResult{
+		Columns:   result.Columns,
+		Rows:      result.Values(),
+		RowCount:  len(result.Rows),
+		Truncated: result.Truncated,
+	}
+	if out.Truncated {
+		out.Note = fmt.Sprintf("only the first %d rows are shown, add a LIMIT or aggregate to see the rest", cfg.MaxRows)
+	}
+	return out, nil
+}
+
+// RegisterQueryTool registers query_database unless it is disabled or has no
+// tables to read.
+func RegisterQueryTool(agent *models.Agent, cfg config.QueryDatabase) {
+	if cfg.Disabled || len(cfg.Tables) == 0 {
+		return
+	}
+	if cfg.MaxRows <= 0 {
+		cfg.MaxRows = 200
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	for i, table := range cfg.Tables {
+		cfg.Tables[i] = strings.ToLower(strings.TrimSpace(table))
+	}
+
+	tool, err := QueryDatabaseTool(agent, cfg)
+	if err != nil {
+		log.Printf("error registering query_database: %v", err)
+		return
+	}
+	agent.Tools.Register(tool)
+}
@@ -1,18 +1,98 @@
 package functions
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"strings"
+	"tempfunctiontools/internal/apperr"
 	"tempfunctiontools/internal/database"
+	"tempfunctiontools/models"
 )
 
-func GetRevenue(month int, year int, db *database.DbConfig) (float64, error) {
-	log.Printf("month: %d, year: %d", month, year)
+// GetRevenueSummary aggregates revenue between two YYYY-MM months, inclusive,
+// in the given currency.
+func GetRevenueSummary(start, end string, filter database.RevenueFilter, groupBy []string, currency string, db *database.DbConfig) (*database.RevenueSummary, error) {
+	log.Printf("revenue summary from %s to %s", start, end)
 
-	// get the revenue
-	rev, err := db.GetRevenueByMonthYear(month, year)
+	from, err := database.ParseYearMonth(start)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	to, err := database.ParseYearMonth(end)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.SummarizeRevenue(context.Background(), from, to, filter, groupBy, currency)
+}
+
+// withDimensions adds the optional dimension filters, the target currency
+// and, if groupable, the group_by parameter to a revenue tool's parameters.
+func withDimensions(params *models.Parameters, groupable bool) *models.Parameters {
+	params.Properties[database.DimRegion] = &models.Parameter{
+		Type:        "string",
+		Description: "Only count revenue of this region, e.g. EMEA. Leave out for all regions.",
+	}
+	params.Properties[database.DimProductLine] = &models.Parameter{
+		Type:        "string",
+		Description: "Only count revenue of this product line. Leave out for all product lines.",
+	}
+	params.Properties[database.DimChannel] = &models.Parameter{
+		Type:        "string",
+		Description: "Only count revenue of this sales channel, e.g. online. Leave out for all channels.",
+	}
+	params.Properties["currency"] = &models.Parameter{
+		Type:        "string",
+		Description: "Three letter code of the currency to report amounts in, e.g. EUR. Amounts are converted with the exchange rate at the end of each month. Leave out to keep the currency the revenue is stored in.",
+	}
+	if groupable {
+		params.Properties["group_by"] = &models.Parameter{
+			Type:        "array",
+			Description: "Dimensions to break the revenue down by, e.g. [\"product_line\"]",
+			Items: &models.Parameter{
+				Type: "string",
+				Enum: database.RevenueDimensions,
+			},
+		}
+	}
+	return params
+}
 
-	return rev.Amount, nil
+// revenueFilter reads the dimension filters from tool arguments.
+func revenueFilter(args map[string]any) database.RevenueFilter {
+	value := func(name string) string {
+		s, _ := args[name].(string)
+		return strings.TrimSpace(s)
+	}
+	return database.RevenueFilter{
+		Region:      value(database.DimRegion),
+		ProductLine: value(database.DimProductLine),
+		Channel:     value(database.DimChannel),
+	}
+}
+
+// revenueCurrency reads the target currency from tool arguments.
+func revenueCurrency(args map[string]any) string {
+	currency, _ := args["currency"].(string)
+	return strings.TrimSpace(currency)
+}
+
+// revenueGroupBy reads group_by from tool arguments, given as a list or a
+// comma-separated string.
+func revenueGroupBy(args map[string]any) ([]string, error) {
+	switch value := args["group_by"].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return database.ParseGroupBy(value)
+	case []any:
+		names := make([]string, 0, len(value))
+		for _, item := range value {
+			names = append(names, fmt.Sprint(item))
+		}
+		return database.ParseGroupBy(names...)
+	default:
+		return nil, apperr.Invalid("group_by", "group_by must be a list of dimensions")
+	}
 }
@@ -1,18 +1,21 @@
 package functions
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
+	"tempfunctiontools/internal/apperr"
 	"tempfunctiontools/models"
 )
 
-func GetWeatherTool(agent *models.Agent) models.Tool {
+func GetWeatherForecastTool(agent *models.Agent) models.Tool {
 	return models.Tool{
 		Type: "function",
 		Function: &models.Function{
-			Name:        "get_current_weather",
-			Description: "Get the current weather for a location",
+			Name:        "get_location_current_and_forecast_weather",
+			Description: "Get a location's current and forecast weather",
 			Parameters: &models.Parameters{
 				Type: "object",
 				Properties: map[string]*models.Parameter{
@@ -23,108 +26,175 @@ func GetWeatherTool(agent *models.Agent) models.Tool {
 					"format": {
 						Type:        "string",
 						Description: "The format to return the weather in, e.g. 'celsius' or 'fahrenheit'",
-						Enum:        []string{"celsius", "fahrenheit"},
+						Enum:        []string{models.Celsius, models.Fahrenheit},
 					},
 				},
 				Required: []string{"location", "format"},
 			},
 		},
-		Execute: func(args map[string]any) (any, error) {
-			location := args["location"].(string)
-			format := args["format"].(string)
-			weather, err := GetCurrentWeather(location, format)
+		Execute: func(ctx context.Context, args map[string]any) (any, error) {
+			location, format, err := weatherArgs(args)
+			if err != nil {
+				return nil, err
+			}
+			weather, err := GetCurrentWeatherForeCast(location, format)
 			if err != nil {
 				return nil, err
 			}
 			return map[string]any{
-				"weather": weather,
+				"location": location,
+				"weather":  weather,
 			}, nil
 		},
 	}
 }
 
-func GetWeatherForecastTool(agent *models.Agent) models.Tool {
+func GetRevenueTool(agent *models.Agent) models.Tool {
 	return models.Tool{
 		Type: "function",
 		Function: &models.Function{
-			Name:        "get_location_current_and_forecast_weather",
-			Description: "Get a location's current and forecast weather",
-			Parameters: &models.Parameters{
+			Name:        "get_revenue_by_month_and_year",
+			Description: "Get the revenue by month and year, optionally for one region, product line or channel, or broken down by them",
+			Parameters: withDimensions(&models.Parameters{
 				Type: "object",
 				Properties: map[string]*models.Parameter{
-					"location": {
-						Type:        "string",
-						Description: "The location to get the weather for, e.g. San Francisco, CA",
+					"month": {
+						Type:        "integer",
+						Description: "The month to get the revenue for, e.g. 1 for January, 2 for February, etc.",
 					},
-					"format": {
-						Type:        "string",
-						Description: "The format to return the weather in, e.g. 'celsius' or 'fahrenheit'",
-						Enum:        []string{models.Celsius, models.Fahrenheit},
+					"year": {
+						Type:        "integer",
+						Description: "The year to get the revenue for, e.g. 2023",
 					},
 				},
-				Required: []string{"location", "format"},
+				Required: []string{"month", "year"},
+			}, true),
+			Examples: []models.Example{
+				{
+					Query: "What was the revenue in March 2023?",
+					Calls: []models.ExampleCall{{Arguments: map[string]any{"month": 3, "year": 2023}}},
+					Note:  "month is a number, not a name",
+				},
+				{
+					Query: "How much revenue did we make in Q2 2023?",
+					Calls: []models.ExampleCall{
+						{Name: "get_quarterly_revenue", Arguments: map[string]any{"quarter": 2, "year": 2023}},
+					},
+					Note: "whole quarters take one get_quarterly_revenue call",
+				},
+				{
+					Query: "What was March 2023 revenue in euros?",
+					Calls: []models.ExampleCall{{Arguments: map[string]any{"month": 3, "year": 2023, "currency": "EUR"}}},
+				},
 			},
 		},
-		Execute: func(args map[string]any) (any, error) {
-			location := args["location"].(string)
-			format := args["format"].(string)
-			weather, err := GetCurrentWeatherForeCast(location, format)
+		Execute: func(ctx context.Context, args map[string]any) (any, error) {
+			month, err := strconv.Atoi(fmt.Sprintf("%v", args["month"]))
+			if err != nil {
+				log.Printf("error converting month to int: %v", err)
+				return nil, apperr.Invalid("month", "month must be a whole number, got %v", args["month"])
+			}
+
+			year, err := strconv.Atoi(fmt.Sprintf("%v", args["year"]))
+			if err != nil {
+				log.Printf("error converting year to int: %v", err)
+				return nil, apperr.Invalid("year", "year must be a whole number, got %v", args["year"])
+			}
+			groupBy, err := revenueGroupBy(args)
 			if err != nil {
 				return nil, err
 			}
-			return map[string]any{
-				"location": location,
-				"weather":  weather,
-			}, nil
+			return agent.Db.MonthRevenue(context.Background(), month, year, revenueFilter(args), groupBy, revenueCurrency(args))
 		},
 	}
+
 }
 
-func GetRevenueTool(agent *models.Agent) models.Tool {
+func GetQuarterlyRevenueTool(agent *models.Agent) models.Tool {
 	return models.Tool{
 		Type: "function",
 		Function: &models.Function{
-			Name:        "get_revenue_by_month_and_year",
-			Description: "Get the revenue by month and year",
-			Parameters: &models.Parameters{
+			Name:        "get_quarterly_revenue",
+			Description: "Get the total revenue of a quarter, with the revenue of each month and the months that have no data, optionally filtered by or broken down by region, product line and channel",
+			Parameters: withDimensions(&models.Parameters{
 				Type: "object",
 				Properties: map[string]*models.Parameter{
-					"month": {
+					"quarter": {
 						Type:        "integer",
-						Description: "The month to get the revenue for, e.g. 1 for January, 2 for February, etc.",
+						Description: "The quarter, 1 to 4",
 					},
 					"year": {
 						Type:        "integer",
-						Description: "The year to get the revenue for, e.g. 2023",
+						Description: "The year, e.g. 2023",
 					},
 				},
-				Required: []string{"month", "year"},
+				Required: []string{"quarter", "year"},
+			}, true),
+			Examples: []models.Example{
+				{
+					Query: "EMEA revenue by product for Q2 2023",
+					Calls: []models.ExampleCall{{Arguments: map[string]any{"quarter": 2, "year": 2023, "region": "EMEA", "group_by": []string{"product_line"}}}},
+				},
 			},
 		},
-		Execute: func(args map[string]any) (any, error) {
-			month, err := strconv.Atoi(fmt.Sprintf("%v", args["month"]))
+		Execute: func(ctx context.Context, args map[string]any) (any, error) {
+			quarter, err := strconv.Atoi(fmt.Sprintf("%v", args["quarter"]))
 			if err != nil {
-				log.Printf("error converting month to int: %v", err)
-				return nil, err
+				log.Printf("error converting quarter to int: %v", err)
+				return nil, apperr.Invalid("quarter", "quarter must be a whole number, got %v", args["quarter"])
 			}
 
 			year, err := strconv.Atoi(fmt.Sprintf("%v", args["year"]))
 			if err != nil {
 				log.Printf("error converting year to int: %v", err)
-				return nil, err
+				return nil, apperr.Invalid("year", "year must be a whole number, got %v", args["year"])
 			}
-			revenue, err := GetRevenue(month, year, agent.Db)
+			groupBy, err := revenueGroupBy(args)
 			if err != nil {
 				return nil, err
 			}
-			return map[string]any{
-				"month":   month,
-				"year":    year,
-				"revenue": revenue,
-			}, nil
+			return agent.Db.QuarterlyRevenue(context.Background(), quarter, year, revenueFilter(args), groupBy, revenueCurrency(args))
 		},
 	}
+}
 
+func GetRevenueSummaryTool(agent *models.Agent) models.Tool {
+	return models.Tool{
+		Type: "function",
+		Function: &models.Function{
+			Name:        "get_revenue_summary",
+			Description: "Get the total, average, minimum and maximum revenue over a range of months, with month-over-month and year-over-year growth. Months without data are listed as missing, not counted as zero. Can be filtered by or broken down by region, product line and channel.",
+			Parameters: withDimensions(&models.Parameters{
+				Type: "object",
+				Properties: map[string]*models.Parameter{
+					"start": {
+						Type:        "string",
+						Description: "The first month of the range as YYYY-MM, e.g. 2023-01",
+					},
+					"end": {
+						Type:        "string",
+						Description: "The last month of the range as YYYY-MM, inclusive, e.g. 2023-06",
+					},
+				},
+				Required: []string{"start", "end"},
+			}, true),
+			Examples: []models.Example{
+				{
+					Query: "What was the total revenue in H1 2023?",
+					Calls: []models.ExampleCall{{Arguments: map[string]any{"start": "2023-01", "end": "2023-06"}}},
+				},
+			},
+		},
+		Execute: func(ctx context.Context, args map[string]any) (any, error) {
+			start, _ := args["start"].(string)
+			end, _ := args["end"].(string)
+			groupBy, err := revenueGroupBy(args)
+			if err != nil {
+				return nil, err
+			}
+			return GetRevenueSummary(start, end, revenueFilter(args), groupBy, revenueCurrency(args), agent.Db)
+		},
+	}
 }
 
 func GetCurrentDateTimeLocationTool(agent *models.Agent) models.Tool {
@@ -134,8 +204,11 @@ func GetCurrentDateTimeLocationTool(agent *models.Agent) models.Tool {
 			Name:        "get_current_location_date_time",
 			Description: "Get the current location, date, time, and time zone information",
 		},
-		Execute: func(args map[string]any) (any, error) {
-			dt := GetCurrentDateTimeLocation()
+		Execute: func(ctx context.Context, args map[string]any) (any, error) {
+			dt, err := GetCurrentDateTimeLocation()
+			if err != nil {
+				return nil, err
+			}
 			return map[string]any{
 				"date":     dt.Date,
 				"time":     dt.Time,
@@ -149,14 +222,72 @@ func GetTools(agent *models.Agent) []models.Tool {
 	return []models.Tool{
 		GetWeatherForecastTool(agent),
 		GetRevenueTool(agent),
+		GetQuarterlyRevenueTool(agent),
+		GetRevenueSummaryTool(agent),
 		GetCurrentDateTimeLocationTool(agent),
 	}
 }
 
+// GetAliases returns the old tool names still used by existing prompts and
+// fine-tuned models.
+func GetAliases() []models.Alias {
+	return []models.Alias{
+		{
+			Name:       "get_current_weather",
+			Target:     "get_location_current_and_forecast_weather",
+			Adapt:      adaptWeatherArgs,
+			Deprecated: true,
+			Note:       "the result now includes the forecast",
+		},
+	}
+}
+
+// weatherArgs returns the location and format arguments of the weather
+// tools.
+func weatherArgs(args map[string]any) (string, string, error) {
+	location, ok := args["location"].(string)
+	if !ok || location == "" {
+		return "", "", apperr.Invalid("location", "location is required, e.g. San Francisco, CA")
+	}
+	format, ok := args["format"].(string)
+	if !ok || format != models.Celsius && format != models.Fahrenheit {
+		return "", "", apperr.Invalid("format", "format must be %s or %s, got %v", models.Celsius, models.Fahrenheit, args["format"])
+	}
+	return location, format, nil
+}
+
+// adaptWeatherArgs accepts the unit spellings older callers send and
+// defaults to celsius when none is given.
+func adaptWeatherArgs(args map[string]any) (map[string]any, error) {
+	location, ok := args["location"].(string)
+	if !ok || location == "" {
+		return nil, apperr.Invalid("location", "location is required")
+	}
+
+	format := models.Celsius
+	if value, ok := args["format"].(string); ok {
+		switch strings.ToLower(value) {
+		case "", "c", "celsius", "metric":
+			format = models.Celsius
+		case "f", "fahrenheit", "imperial":
+			format = models.Fahrenheit
+		default:
+			return nil, apperr.Invalid("format", "unknown format %q, use celsius or fahrenheit", value)
+		}
+	}
+
+	return map[string]any{"location": location, "format": format}, nil
+}
+
 // register tools
 
 func RegisterTools(agent *models.Agent) {
 	for _, tool := range GetTools(agent) {
-		agent.Tools[tool.Function.Name] = tool
+		agent.Tools.Register(tool)
+	}
+	for _, alias := range GetAliases() {
+		if err := agent.Tools.RegisterAlias(alias); err != nil {
+			log.Printf("error registering alias %s: %v", alias.Name, err)
+		}
 	}
 }
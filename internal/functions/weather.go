@@ -3,42 +3,13 @@ package functions
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"tempfunctiontools/internal/apperr"
+	"tempfunctiontools/internal/resilience"
 	"tempfunctiontools/models"
 )
 
-func GetCurrentWeather(location string, format string) (string, error) {
-	log.Println("Getting current weather for location", location, "in format", format)
-	client := &http.Client{}
-
-	req, err := http.NewRequest("GET", "https://wttr.in/"+location+"?format=%f", nil)
-	log.Println("req", req)
-
-	if err != nil {
-		log.Printf("error creating request: %v", err)
-		return "", err
-	}
-	resp, err := client.Do(req)
-
-	if err != nil {
-		log.Printf("error calling API: %v", err)
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	var weather string
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("error reading response: %v", err)
-		return "", err
-	}
-	weather = string(body)
-	return fmt.Sprintf("Current weather for location %s in format %s is %s", location, format, weather), nil
-}
-
 func GetCurrentWeatherForeCast(location string, format string) (models.WeatherResponse, error) {
 	log.Println("Getting current weather for location", location, "in format", format)
 	client := &http.Client{}
@@ -52,7 +23,7 @@ func GetCurrentWeatherForeCast(location string, format string) (models.WeatherRe
 		log.Printf("error creating request: %v", err)
 		return result, err
 	}
-	resp, err := client.Do(req)
+	resp, err := resilience.Get(resilience.WttrIn).Do(client, req)
 	if err != nil {
 		log.Printf("error calling API: %v", err)
 		return result, err
@@ -63,7 +34,7 @@ func GetCurrentWeatherForeCast(location string, format string) (models.WeatherRe
 	var weather models.Weather
 	if err := json.NewDecoder(resp.Body).Decode(&weather); err != nil {
 		log.Printf("error decoding response: %v", err)
-		return result, err
+		return result, apperr.Upstream(resilience.WttrIn, resp.StatusCode, fmt.Errorf("no forecast for %s: %w", location, err))
 	}
 
 	result = CreateResponse(format, weather)
@@ -0,0 +1,161 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"tempfunctiontools/internal/apperr"
+	"tempfunctiontools/internal/config"
+)
+
+const (
+	clientName    = "tempfunctiontools"
+	clientVersion = "1.0.0"
+)
+
+// Client is a connection to a single MCP server.
+type Client struct {
+	Name string
+
+	transport transport
+	nextID    atomic.Int64
+}
+
+// Connect starts or connects to the server described by cfg and performs the
+// initialize handshake.
+func Connect(ctx context.Context, cfg config.MCPServer) (*Client, error) {
+	var t transport
+	switch {
+	case cfg.Command != "":
+		stdio, err := newStdioTransport(cfg)
+		if err != nil {
+			return nil, err
+		}
+		t = stdio
+	case cfg.URL != "":
+		t = newHTTPTransport(cfg)
+	default:
+		return nil, fmt.Errorf("mcp server %q has neither command nor url", cfg.Name)
+	}
+
+	client := &Client{Name: cfg.Name, transport: t}
+
+	if err := client.initialize(ctx); err != nil {
+		t.close()
+		return nil, fmt.Errorf("failed to initialize mcp server %q: %w", cfg.Name, err)
+	}
+
+	return client, nil
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	params := InitializeParams{
+		ProtocolVersion: protocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      Implementation{Name: clientName, Version: clientVersion},
+	}
+
+	var result InitializeResult
+	if err := c.call(ctx, MethodInitialize, params, &result); err != nil {
+		return err
+	}
+
+	log.Printf("mcp: connected to %s (%s %s, protocol %s)", c.Name, result.ServerInfo.Name, result.ServerInfo.Version, result.ProtocolVersion)
+
+	return c.transport.notify(ctx, &Request{JSONRPC: jsonRPCVersion, Method: MethodInitialized})
+}
+
+// ListTools returns every tool the server exposes, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	cursor := ""
+	for {
+		var result ListToolsResult
+		if err := c.call(ctx, MethodToolsList, ListToolsParams{Cursor: cursor}, &result); err != nil {
+			return nil, err
+		}
+		tools = append(tools, result.Tools...)
+
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// CallTool invokes a tool on the server. A result flagged with isError is
+// returned as an error carrying the text content.
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]any) (*CallToolResult, error) {
+	var result CallToolResult
+	if err := c.call(ctx, MethodToolsCall, CallToolParams{Name: name, Arguments: args}, &result); err != nil {
+		return nil, err
+	}
+
+	if result.IsError {
+		return nil, apperr.Upstream(c.Name, 0, fmt.Errorf("tool %s failed: %s", name, result.Text()))
+	}
+
+	return &result, nil
+}
+
+func (c *Client) Close() error {
+	return c.transport.close()
+}
+
+func (c *Client) call(ctx context.Context, method string, params any, result any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal params: %w", err)
+	}
+
+	req := &Request{
+		JSONRPC: jsonRPCVersion,
+		ID:      json.RawMessage(strconv.FormatInt(c.nextID.Add(1), 10)),
+		Method:  method,
+		Params:  data,
+	}
+
+	resp, err := c.transport.call(ctx, req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%s: %w", method, resp.Error)
+	}
+
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("%s: failed to decode result: %w", method, err)
+	}
+	return nil
+}
+
+// Text joins the text content blocks of the result.
+func (r *CallToolResult) Text() string {
+	var parts []string
+	for _, content := range r.Content {
+		if content.Type == "text" {
+			parts = append(parts, content.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Value returns the result in the form handed back to the model: structured
+// content when present, otherwise the text decoded as JSON if possible.
+func (r *CallToolResult) Value() any {
+	if r.StructuredContent != nil {
+		return r.StructuredContent
+	}
+
+	text := r.Text()
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err == nil {
+		return value
+	}
+	return text
+}
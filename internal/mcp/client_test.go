@@ -0,0 +1,129 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tempfunctiontools/internal/apperr"
+	"tempfunctiontools/internal/config"
+	"tempfunctiontools/models"
+)
+
+// echoServer is the path of the built testdata/echoserver fixture.
+var echoServer string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "echoserver")
+	if err != nil {
+		panic(err)
+	}
+	echoServer = filepath.Join(dir, "echoserver")
+	if out, err := exec.Command("go", "build", "-o", echoServer, "./testdata/echoserver").CombinedOutput(); err != nil {
+		panic("failed to build echoserver: " + err.Error() + "\n" + string(out))
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func connectEchoServer(t *testing.T) *Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := Connect(ctx, config.MCPServer{Name: "fixture", Command: echoServer})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestClientListTools(t *testing.T) {
+	client := connectEchoServer(t)
+
+	tools, err := client.ListTools(context.Background())
+	if err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	if strings.Join(names, ",") != "echo,add" {
+		t.Fatalf("got tools %v, want echo and add", names)
+	}
+
+	params := tools[1].InputSchema.ToParameters()
+	if params.Properties["a"] == nil || params.Properties["a"].Type != "number" || len(params.Required) != 2 {
+		t.Errorf("add parameters not converted: %+v", params)
+	}
+}
+
+func TestClientCallTool(t *testing.T) {
+	client := connectEchoServer(t)
+	ctx := context.Background()
+
+	result, err := client.CallTool(ctx, "echo", map[string]any{"message": "hello"})
+	if err != nil {
+		t.Fatalf("echo: %v", err)
+	}
+	if result.Text() != "hello" {
+		t.Errorf("echo returned %q, want hello", result.Text())
+	}
+
+	result, err = client.CallTool(ctx, "add", map[string]any{"a": 2, "b": 3.5})
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if value := result.Value(); value != 5.5 {
+		t.Errorf("add returned %v, want 5.5", value)
+	}
+}
+
+func TestClientCallToolError(t *testing.T) {
+	client := connectEchoServer(t)
+
+	_, err := client.CallTool(context.Background(), "missing", nil)
+	if err == nil {
+		t.Fatal("calling an unknown tool succeeded")
+	}
+	if !errors.Is(err, apperr.ErrUpstream) {
+		t.Errorf("got %v, want an upstream error", err)
+	}
+	if !strings.Contains(err.Error(), "unknown tool missing") {
+		t.Errorf("error %q does not carry the server's text", err)
+	}
+}
+
+func TestRegisterTools(t *testing.T) {
+	agent := &models.Agent{Tools: models.NewToolRegistry()}
+	clients := RegisterTools(context.Background(), agent, []config.MCPServer{
+		{Name: "fixture", Command: echoServer, Prefix: "fx_"},
+		{Name: "broken", Command: filepath.Join(t.TempDir(), "missing")},
+	})
+	defer func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}()
+	if len(clients) != 1 {
+		t.Fatalf("got %d clients, want the fixture only", len(clients))
+	}
+
+	tool, err := agent.Tools.Get("fx_echo")
+	if err != nil {
+		t.Fatalf("fx_echo not registered: %v", err)
+	}
+	result, err := tool.Execute(context.Background(), map[string]any{"message": "hi"})
+	if err != nil || result != "hi" {
+		t.Errorf("fx_echo returned %v, %v", result, err)
+	}
+}
@@ -0,0 +1,39 @@
+package mcp
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Guard wraps the HTTP transport with the checks the streamable HTTP spec
+// asks for. A browser request from an origin not in origins is refused, so
+// a web page cannot reach the server through DNS rebinding, and every
+// request must carry "Authorization: Bearer <token>". An empty token lets
+// nothing through.
+func Guard(next http.Handler, token string, origins []string) http.Handler {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[normalizeOrigin(origin)] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" && !allowed[normalizeOrigin(origin)] {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		scheme, key, _ := strings.Cut(strings.TrimSpace(r.Header.Get("Authorization")), " ")
+		if token == "" || !strings.EqualFold(scheme, "Bearer") || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(key)), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "a valid bearer token is required", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func normalizeOrigin(origin string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+}
@@ -0,0 +1,38 @@
+package mcp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGuard(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		token  string
+		origin string
+		auth   string
+		want   int
+	}{
+		{"secret", "", "Bearer secret", http.StatusOK},
+		{"secret", "https://app.example.com/", "bearer secret", http.StatusOK},
+		{"secret", "", "", http.StatusUnauthorized},
+		{"secret", "", "Bearer wrong", http.StatusUnauthorized},
+		{"secret", "http://evil.example", "Bearer secret", http.StatusForbidden},
+		{"", "", "Bearer ", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		if test.auth != "" {
+			req.Header.Set("Authorization", test.auth)
+		}
+		rec := httptest.NewRecorder()
+		Guard(ok, test.token, []string{"https://app.example.com"}).ServeHTTP(rec, req)
+		if rec.Code != test.want {
+			t.Errorf("token %q, origin %q, auth %q: got %d, want %d", test.token, test.origin, test.auth, rec.Code, test.want)
+		}
+	}
+}
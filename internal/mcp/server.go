@@ -0,0 +1,233 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync"
+
+	"tempfunctiontools/internal/apperr"
+	"tempfunctiontools/models"
+)
+
+const (
+	serverName    = "tempfunctiontools"
+	serverVersion = "1.0.0"
+)
+
+// Server publishes the agent's registered tools over MCP. tools/list is built
+// from agent.Tools on every call, so tools registered later are picked up.
+type Server struct {
+	agent *models.Agent
+}
+
+func NewServer(agent *models.Agent) *Server {
+	return &Server{agent: agent}
+}
+
+// Handle processes a single JSON-RPC message. It returns nil for
+// notifications, which get no response.
+func (s *Server) Handle(ctx context.Context, req *Request) *Response {
+	if len(req.ID) == 0 {
+		return nil
+	}
+
+	resp := &Response{JSONRPC: jsonRPCVersion, ID: req.ID}
+
+	result, err := s.dispatch(ctx, req)
+	if err != nil {
+		rpcErr, ok := err.(*RPCError)
+		if !ok {
+			rpcErr = &RPCError{Code: CodeInternalError, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+		return resp
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		resp.Error = &RPCError{Code: CodeInternalError, Message: err.Error()}
+		return resp
+	}
+	resp.Result = data
+
+	return resp
+}
+
+// handleRecover is Handle with a panic, e.g. in a tool, answered with an
+// internal error instead of taking the server down.
+func (s *Server) handleRecover(ctx context.Context, req *Request) (resp *Response) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("mcp: panic handling %s: %v\n%s", req.Method, r, debug.Stack())
+			resp = nil
+			if len(req.ID) > 0 {
+				resp = &Response{
+					JSONRPC: jsonRPCVersion,
+					ID:      req.ID,
+					Error:   &RPCError{Code: CodeInternalError, Message: fmt.Sprintf("internal error: %v", r)},
+				}
+			}
+		}
+	}()
+	return s.Handle(ctx, req)
+}
+
+func (s *Server) dispatch(ctx context.Context, req *Request) (any, error) {
+	switch req.Method {
+	case MethodInitialize:
+		return InitializeResult{
+			ProtocolVersion: protocolVersion,
+			Capabilities:    map[string]any{"tools": map[string]any{}},
+			ServerInfo:      Implementation{Name: serverName, Version: serverVersion},
+		}, nil
+	case MethodPing:
+		return struct{}{}, nil
+	case MethodToolsList:
+		return ListToolsResult{Tools: s.listTools()}, nil
+	case MethodToolsCall:
+		var params CallToolParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &RPCError{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		return s.callTool(ctx, params)
+	default:
+		return nil, &RPCError{Code: CodeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+}
+
+func (s *Server) listTools() []Tool {
+	tools := []Tool{}
+	for _, tool := range s.agent.ToolList() {
+		schema := models.SchemaFromParameters(tool.Function.Parameters)
+		tools = append(tools, Tool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	return tools
+}
+
+// callTool runs a registered tool. Tool failures are reported in the result
+// with isError set so that the calling model can see them. Tools that require
+// approval are refused, there is no reviewer to hold them for.
+func (s *Server) callTool(ctx context.Context, params CallToolParams) (*CallToolResult, error) {
+	if _, err := s.agent.Tools.GetUnapproved(params.Name); err != nil {
+		return nil, &RPCError{Code: CodeInvalidParams, Message: err.Error()}
+	}
+
+	log.Printf("mcp: calling tool %s with %v", params.Name, params.Arguments)
+
+	call, err := models.NewToolCall("", params.Name, params.Arguments)
+	if err != nil {
+		return nil, &RPCError{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	result, err := s.agent.CallTool(ctx, call, false)
+	if err != nil {
+		return &CallToolResult{
+			Content: []Content{{Type: "text", Text: apperr.ToolMessage(err)}},
+			IsError: true,
+		}, nil
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	toolResult := &CallToolResult{Content: []Content{{Type: "text", Text: string(data)}}}
+	if _, ok := result.(map[string]any); ok {
+		toolResult.StructuredContent = result
+	}
+	return toolResult, nil
+}
+
+// ServeStdio serves newline-delimited JSON-RPC messages from r, writing
+// responses to w, until r is exhausted.
+func (s *Server) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var writeMu sync.Mutex
+	encoder := json.NewEncoder(w)
+	write := func(resp *Response) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if err := encoder.Encode(resp); err != nil {
+			log.Printf("mcp: failed to write response: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for scanner.Scan() {
+		req := &Request{}
+		if err := json.Unmarshal(scanner.Bytes(), req); err != nil {
+			write(&Response{
+				JSONRPC: jsonRPCVersion,
+				ID:      json.RawMessage("null"),
+				Error:   &RPCError{Code: CodeParseError, Message: err.Error()},
+			})
+			continue
+		}
+
+		// tool calls may be slow, so handle each request concurrently
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp := s.handleRecover(ctx, req); resp != nil {
+				write(resp)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return scanner.Err()
+}
+
+// ServeHTTP implements the streamable HTTP transport. Each POST carries one
+// JSON-RPC message and is answered with plain JSON; the server does not open
+// SSE streams, so GET is rejected.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req := &Request{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeJSON(w, http.StatusBadRequest, &Response{
+			JSONRPC: jsonRPCVersion,
+			ID:      json.RawMessage("null"),
+			Error:   &RPCError{Code: CodeParseError, Message: err.Error()},
+		})
+		return
+	}
+
+	resp := s.handleRecover(r.Context(), req)
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("mcp: failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+// Command echoserver is a tiny stdio MCP server the MCP client tests run
+// against. It exposes an "echo" and an "add" tool and can be used by hand too:
+//
+//	mcp_servers:
+//	  - name: fixture
+//	    command: go
+//	    args: ["run", "./internal/mcp/testdata/echoserver"]
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type request struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+var tools = []map[string]any{
+	{
+		"name":        "echo",
+		"description": "Echo the given message back",
+		"inputSchema": map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"message": map[string]any{"type": "string"}},
+			"required":   []string{"message"},
+		},
+	},
+	{
+		"name":        "add",
+		"description": "Add two numbers",
+		"inputSchema": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"a": map[string]any{"type": "number"},
+				"b": map[string]any{"type": "number"},
+			},
+			"required": []string{"a", "b"},
+		},
+	},
+}
+
+func main() {
+	scanner := bufio.NewScanner(os.Stdin)
+	out := json.NewEncoder(os.Stdout)
+
+	for scanner.Scan() {
+		var req request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil || len(req.ID) == 0 {
+			continue
+		}
+
+		resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+		switch req.Method {
+		case "initialize":
+			resp["result"] = map[string]any{
+				"protocolVersion": "2025-03-26",
+				"capabilities":    map[string]any{"tools": map[string]any{}},
+				"serverInfo":      map[string]any{"name": "echoserver", "version": "0.1.0"},
+			}
+		case "tools/list":
+			resp["result"] = map[string]any{"tools": tools}
+		case "tools/call":
+			resp["result"] = call(req.Params)
+		default:
+			resp["error"] = map[string]any{"code": -32601, "message": "method not found"}
+		}
+
+		out.Encode(resp)
+	}
+}
+
+func call(raw json.RawMessage) map[string]any {
+	var params struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	}
+	json.Unmarshal(raw, &params)
+
+	var text string
+	switch params.Name {
+	case "echo":
+		text = fmt.Sprint(params.Arguments["message"])
+	case "add":
+		a, _ := params.Arguments["a"].(float64)
+		b, _ := params.Arguments["b"].(float64)
+		text = fmt.Sprint(a + b)
+	default:
+		return map[string]any{
+			"content": []map[string]any{{"type": "text", "text": "unknown tool " + params.Name}},
+			"isError": true,
+		}
+	}
+
+	return map[string]any{"content": []map[string]any{{"type": "text", "text": text}}}
+}
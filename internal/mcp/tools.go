@@ -0,0 +1,75 @@
+package mcp
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"tempfunctiontools/internal/config"
+	"tempfunctiontools/models"
+)
+
+const (
+	connectTimeout = 30 * time.Second
+	callTimeout    = 60 * time.Second
+)
+
+// RegisterTools connects to every configured MCP server and registers its
+// tools into agent.Tools. Servers that fail to start are logged and skipped.
+// The returned clients must be closed on shutdown.
+func RegisterTools(ctx context.Context, agent *models.Agent, servers []config.MCPServer) []*Client {
+	var clients []*Client
+
+	for _, server := range servers {
+		connectCtx, cancel := context.WithTimeout(ctx, connectTimeout)
+		client, err := Connect(connectCtx, server)
+		if err != nil {
+			cancel()
+			log.Printf("mcp: skipping server %s: %v", server.Name, err)
+			continue
+		}
+
+		tools, err := client.ListTools(connectCtx)
+		cancel()
+		if err != nil {
+			log.Printf("mcp: failed to list tools of %s: %v", server.Name, err)
+			client.Close()
+			continue
+		}
+
+		for _, tool := range tools {
+			name := server.Prefix + tool.Name
+			if !agent.Tools.Register(NewTool(client, name, tool)) {
+				log.Printf("mcp: tool %s from %s already registered, skipping", name, server.Name)
+			}
+		}
+
+		log.Printf("mcp: registered %d tools from %s", len(tools), server.Name)
+		clients = append(clients, client)
+	}
+
+	return clients
+}
+
+// NewTool wraps a remote MCP tool so that executing it is routed through
+// tools/call on the given client.
+func NewTool(client *Client, name string, tool Tool) models.Tool {
+	return models.Tool{
+		Type: "function",
+		Function: &models.Function{
+			Name:        name,
+			Description: tool.Description,
+			Parameters:  tool.InputSchema.ToParameters(),
+		},
+		Execute: func(ctx context.Context, args map[string]any) (any, error) {
+			ctx, cancel := context.WithTimeout(ctx, callTimeout)
+			defer cancel()
+
+			result, err := client.CallTool(ctx, tool.Name, args)
+			if err != nil {
+				return nil, err
+			}
+			return result.Value(), nil
+		},
+	}
+}
@@ -0,0 +1,344 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"tempfunctiontools/internal/config"
+)
+
+const sessionHeader = "Mcp-Session-Id"
+
+// transport carries JSON-RPC messages to a server.
+type transport interface {
+	call(ctx context.Context, req *Request) (*Response, error)
+	notify(ctx context.Context, req *Request) error
+	close() error
+}
+
+// stdioTransport runs the server as a subprocess and exchanges
+// newline-delimited JSON messages over its stdin and stdout.
+type stdioTransport struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]chan *Response
+	err     error
+	done    chan struct{}
+}
+
+func newStdioTransport(cfg config.MCPServer) (*stdioTransport, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Dir = cfg.Dir
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	for k, v := range cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stdout: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", cfg.Command, err)
+	}
+
+	t := &stdioTransport{
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[string]chan *Response),
+		done:    make(chan struct{}),
+	}
+	go t.readLoop(stdout)
+
+	return t, nil
+}
+
+func (t *stdioTransport) readLoop(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var msg struct {
+			Response
+			Method string `json:"method"`
+		}
+		if err := json.Unmarshal(line, &msg); err != nil {
+			log.Printf("mcp: invalid message from server: %v", err)
+			continue
+		}
+
+		if msg.Method != "" {
+			t.handleServerMessage(msg.ID, msg.Method)
+			continue
+		}
+
+		t.mu.Lock()
+		ch, ok := t.pending[string(msg.ID)]
+		delete(t.pending, string(msg.ID))
+		t.mu.Unlock()
+
+		if ok {
+			resp := msg.Response
+			ch <- &resp
+		}
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+
+	t.mu.Lock()
+	t.err = err
+	t.mu.Unlock()
+	close(t.done)
+}
+
+// handleServerMessage answers requests initiated by the server. Only ping is
+// supported; notifications are ignored.
+func (t *stdioTransport) handleServerMessage(id json.RawMessage, method string) {
+	if len(id) == 0 {
+		return
+	}
+
+	resp := Response{JSONRPC: jsonRPCVersion, ID: id}
+	if method == MethodPing {
+		resp.Result = json.RawMessage("{}")
+	} else {
+		resp.Error = &RPCError{Code: CodeMethodNotFound, Message: "method not found: " + method}
+	}
+
+	if err := t.write(resp); err != nil {
+		log.Printf("mcp: failed to answer %s: %v", method, err)
+	}
+}
+
+func (t *stdioTransport) write(msg any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) call(ctx context.Context, req *Request) (*Response, error) {
+	ch := make(chan *Response, 1)
+
+	t.mu.Lock()
+	if t.err != nil {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("server exited: %w", t.err)
+	}
+	t.pending[string(req.ID)] = ch
+	t.mu.Unlock()
+
+	if err := t.write(req); err != nil {
+		t.mu.Lock()
+		delete(t.pending, string(req.ID))
+		t.mu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-t.done:
+		return nil, fmt.Errorf("server exited: %w", t.err)
+	case <-ctx.Done():
+		t.mu.Lock()
+		delete(t.pending, string(req.ID))
+		t.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (t *stdioTransport) notify(ctx context.Context, req *Request) error {
+	return t.write(req)
+}
+
+func (t *stdioTransport) close() error {
+	t.stdin.Close()
+	return t.cmd.Wait()
+}
+
+// httpTransport implements the streamable HTTP transport. Every message is
+// POSTed to the endpoint and the reply is either plain JSON or an SSE stream.
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+func newHTTPTransport(cfg config.MCPServer) *httpTransport {
+	return &httpTransport{
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		client:  &http.Client{},
+	}
+}
+
+func (t *httpTransport) post(ctx context.Context, req *Request) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json, text/event-stream")
+	for k, v := range t.headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	t.mu.Lock()
+	if t.sessionID != "" {
+		httpReq.Header.Set(sessionHeader, t.sessionID)
+	}
+	t.mu.Unlock()
+
+	resp, err := t.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if id := resp.Header.Get(sessionHeader); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	return resp, nil
+}
+
+func (t *httpTransport) call(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		return readEventStream(resp.Body, req.ID)
+	}
+
+	result := &Response{}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result, nil
+}
+
+// readEventStream reads SSE events until the response matching id arrives.
+func readEventStream(r io.Reader, id json.RawMessage) (*Response, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "data:") {
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+
+		// blank line terminates the event
+		resp := &Response{}
+		err := json.Unmarshal([]byte(data.String()), resp)
+		data.Reset()
+		if err != nil {
+			log.Printf("mcp: invalid event from server: %v", err)
+			continue
+		}
+		if string(resp.ID) == string(id) {
+			return resp, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("event stream closed without a response")
+}
+
+func (t *httpTransport) notify(ctx context.Context, req *Request) error {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (t *httpTransport) close() error {
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+
+	if sessionID == "" {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(sessionHeader, sessionID)
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
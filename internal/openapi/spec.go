@@ -0,0 +1,177 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"tempfunctiontools/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxRefDepth bounds $ref expansion so recursive schemas terminate.
+const maxRefDepth = 3
+
+var methods = []string{"get", "put", "post", "delete", "patch"}
+
+// Document is the part of an OpenAPI 3 document needed to build tools.
+type Document struct {
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	Summary     string       `json:"summary"`
+	Description string       `json:"description"`
+	Parameters  []Parameter  `json:"parameters"`
+	RequestBody *RequestBody `json:"requestBody"`
+
+	Method string `json:"-"`
+	Path   string `json:"-"`
+}
+
+type Parameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description"`
+	Required    bool           `json:"required"`
+	Schema      *models.Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+	Content     map[string]struct {
+		Schema *models.Schema `json:"schema"`
+	} `json:"content"`
+}
+
+// LoadDocument reads a YAML or JSON OpenAPI document and inlines every local
+// $ref so that operations can be read without a components lookup.
+func LoadDocument(path string) (*Document, []Operation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read spec: %w", err)
+	}
+
+	var raw any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse spec: %w", err)
+	}
+
+	resolved := resolveRefs(raw, raw, 0)
+
+	// round-trip through JSON to decode into typed structs
+	data, err = json.Marshal(resolved)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode spec: %w", err)
+	}
+
+	doc := &Document{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode spec: %w", err)
+	}
+
+	var operations []Operation
+	for path, item := range doc.Paths {
+		var shared []Parameter
+		if rawParams, ok := item["parameters"]; ok {
+			if err := json.Unmarshal(rawParams, &shared); err != nil {
+				return nil, nil, fmt.Errorf("invalid parameters for %s: %w", path, err)
+			}
+		}
+
+		for _, method := range methods {
+			rawOp, ok := item[method]
+			if !ok {
+				continue
+			}
+
+			op := Operation{}
+			if err := json.Unmarshal(rawOp, &op); err != nil {
+				return nil, nil, fmt.Errorf("invalid operation %s %s: %w", method, path, err)
+			}
+			op.Method = strings.ToUpper(method)
+			op.Path = path
+			op.Parameters = mergeParameters(shared, op.Parameters)
+
+			operations = append(operations, op)
+		}
+	}
+
+	return doc, operations, nil
+}
+
+// mergeParameters combines path-level and operation-level parameters, the
+// latter overriding the former.
+func mergeParameters(shared, own []Parameter) []Parameter {
+	merged := append([]Parameter{}, own...)
+	for _, param := range shared {
+		overridden := false
+		for _, p := range own {
+			if p.Name == param.Name && p.In == param.In {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			merged = append(merged, param)
+		}
+	}
+	return merged
+}
+
+// resolveRefs replaces {"$ref": "#/..."} nodes with the referenced node.
+func resolveRefs(node any, root any, depth int) any {
+	switch v := node.(type) {
+	case map[string]any:
+		if ref, ok := v["$ref"].(string); ok {
+			if depth >= maxRefDepth {
+				return map[string]any{"type": "object"}
+			}
+			target, err := lookupRef(root, ref)
+			if err != nil {
+				return map[string]any{}
+			}
+			return resolveRefs(target, root, depth+1)
+		}
+
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			out[key] = resolveRefs(value, root, depth)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, value := range v {
+			out[i] = resolveRefs(value, root, depth)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func lookupRef(root any, ref string) (any, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %s", ref)
+	}
+
+	node := root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %s", ref)
+		}
+		if node, ok = m[part]; !ok {
+			return nil, fmt.Errorf("unresolvable $ref %s", ref)
+		}
+	}
+	return node, nil
+}
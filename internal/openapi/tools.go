@@ -0,0 +1,276 @@
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"tempfunctiontools/internal/apperr"
+	"tempfunctiontools/internal/config"
+	"tempfunctiontools/models"
+)
+
+const (
+	requestTimeout  = 30 * time.Second
+	maxResponseSize = 1 << 20
+	maxToolName     = 64
+
+	// bodyParam is the tool argument holding the JSON request body.
+	bodyParam = "body"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// RegisterTools loads every configured spec and registers the selected
+// operations into agent.Tools. Specs that fail to load are logged and skipped.
+func RegisterTools(agent *models.Agent, specs []config.OpenAPISpec) {
+	for _, spec := range specs {
+		tools, err := LoadTools(spec)
+		if err != nil {
+			log.Printf("openapi: skipping spec %s: %v", spec.Spec, err)
+			continue
+		}
+
+		for _, tool := range tools {
+			if !agent.Tools.Register(tool) {
+				log.Printf("openapi: tool %s from %s already registered, skipping", tool.Function.Name, spec.Spec)
+			}
+		}
+
+		log.Printf("openapi: registered %d tools from %s", len(tools), spec.Spec)
+	}
+}
+
+// LoadTools builds one tool per allowed operation of the spec.
+func LoadTools(spec config.OpenAPISpec) ([]models.Tool, error) {
+	doc, operations, err := LoadDocument(spec.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := spec.BaseURL
+	if baseURL == "" && len(doc.Servers) > 0 {
+		baseURL = doc.Servers[0].URL
+	}
+	if baseURL == "" {
+		return nil, fmt.Errorf("no base url configured and none in spec")
+	}
+
+	headers := make(map[string]string, len(spec.Headers))
+	for k, v := range spec.Headers {
+		headers[k] = os.ExpandEnv(v)
+	}
+
+	executor := &httpExecutor{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		headers: headers,
+		client:  &http.Client{Timeout: requestTimeout},
+	}
+
+	var tools []models.Tool
+	for _, op := range operations {
+		if len(spec.Operations) > 0 && !slices.Contains(spec.Operations, op.OperationID) {
+			continue
+		}
+		tools = append(tools, executor.newTool(spec.Prefix, op))
+	}
+
+	return tools, nil
+}
+
+func toolName(prefix string, op Operation) string {
+	name := op.OperationID
+	if name == "" {
+		name = strings.ToLower(op.Method) + "_" + op.Path
+	}
+	name = strings.Trim(invalidNameChars.ReplaceAllString(prefix+name, "_"), "_")
+	if len(name) > maxToolName {
+		name = name[:maxToolName]
+	}
+	return name
+}
+
+// parameters builds the tool schema from the path, query and header
+// parameters plus the JSON request body, which is passed as "body".
+func parameters(op Operation) *models.Parameters {
+	params := &models.Parameters{
+		Type:       "object",
+		Properties: map[string]*models.Parameter{},
+	}
+
+	for _, p := range op.Parameters {
+		if p.In == "cookie" {
+			continue
+		}
+		param := p.Schema.ToParameter()
+		if p.Description != "" {
+			param.Description = p.Description
+		}
+		params.Properties[p.Name] = param
+		if p.Required || p.In == "path" {
+			params.Required = append(params.Required, p.Name)
+		}
+	}
+
+	if schema := op.jsonBodySchema(); schema != nil {
+		param := schema.ToParameter()
+		if op.RequestBody.Description != "" {
+			param.Description = op.RequestBody.Description
+		}
+		params.Properties[bodyParam] = param
+		if op.RequestBody.Required {
+			params.Required = append(params.Required, bodyParam)
+		}
+	}
+
+	if len(params.Properties) == 0 {
+		return nil
+	}
+	return params
+}
+
+func (op Operation) jsonBodySchema() *models.Schema {
+	if op.RequestBody == nil {
+		return nil
+	}
+	for mediaType, content := range op.RequestBody.Content {
+		if strings.Contains(mediaType, "json") {
+			if content.Schema == nil {
+				return &models.Schema{Type: "object"}
+			}
+			return content.Schema
+		}
+	}
+	return nil
+}
+
+func (op Operation) description() string {
+	desc := op.Summary
+	if op.Description != "" {
+		if desc != "" {
+			desc += ". "
+		}
+		desc += op.Description
+	}
+	if desc == "" {
+		desc = op.Method + " " + op.Path
+	}
+	return desc
+}
+
+type httpExecutor struct {
+	baseURL string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (e *httpExecutor) newTool(prefix string, op Operation) models.Tool {
+	return models.Tool{
+		Type: "function",
+		Function: &models.Function{
+			Name:        toolName(prefix, op),
+			Description: op.description(),
+			Parameters:  parameters(op),
+		},
+		Execute: func(ctx context.Context, args map[string]any) (any, error) {
+			return e.execute(op, args)
+		},
+	}
+}
+
+// execute performs the HTTP call for op and returns the status and the
+// decoded response body.
+func (e *httpExecutor) execute(op Operation, args map[string]any) (any, error) {
+	path := op.Path
+	query := url.Values{}
+	headers := http.Header{}
+
+	for _, p := range op.Parameters {
+		value, ok := args[p.Name]
+		if !ok {
+			if p.Required || p.In == "path" {
+				return nil, apperr.Invalid(p.Name, "missing required parameter %s", p.Name)
+			}
+			continue
+		}
+
+		switch p.In {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+p.Name+"}", url.PathEscape(fmt.Sprint(value)))
+		case "query":
+			if values, ok := value.([]any); ok {
+				for _, v := range values {
+					query.Add(p.Name, fmt.Sprint(v))
+				}
+			} else {
+				query.Set(p.Name, fmt.Sprint(value))
+			}
+		case "header":
+			headers.Set(p.Name, fmt.Sprint(value))
+		}
+	}
+
+	target := e.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if value, ok := args[bodyParam]; ok && op.jsonBodySchema() != nil {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode body: %w", err)
+		}
+		body = bytes.NewReader(data)
+		headers.Set("Content-Type", "application/json")
+	}
+
+	req, err := http.NewRequest(op.Method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header = headers
+	req.Header.Set("Accept", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	log.Printf("openapi: %s %s", op.Method, target)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		log.Printf("error calling API: %v", err)
+		return nil, apperr.Upstream(req.URL.Host, 0, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var result any = string(data)
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err == nil {
+		result = decoded
+	}
+
+	if resp.StatusCode >= 300 {
+		return nil, apperr.Upstream(req.URL.Host, resp.StatusCode, fmt.Errorf("%s %s returned %d: %s", op.Method, op.Path, resp.StatusCode, strings.TrimSpace(string(data))))
+	}
+
+	return map[string]any{
+		"status": resp.StatusCode,
+		"body":   result,
+	}, nil
+}
@@ -0,0 +1,209 @@
+package resilience
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"tempfunctiontools/internal/apperr"
+	"tempfunctiontools/internal/config"
+)
+
+const (
+	WttrIn  = "wttr.in"
+	IPAPI   = "ip-api.com"
+	retryIn = time.Second
+)
+
+// defaults used for backends and fields missing from the config
+var defaultBackends = map[string]config.Backend{
+	// wttr.in has no published limit, stay polite
+	WttrIn: {Rate: 1, Burst: 5, FailureThreshold: 5, OpenTimeout: 30 * time.Second, Timeout: 10 * time.Second},
+	// ip-api.com free tier allows 45 requests per minute
+	IPAPI: {Rate: 0.75, Burst: 5, FailureThreshold: 5, OpenTimeout: time.Minute, Timeout: 5 * time.Second},
+}
+
+// fallbackBackend is the default of backends without their own.
+var fallbackBackend = config.Backend{Rate: 5, Burst: 10, FailureThreshold: 5, OpenTimeout: 30 * time.Second, Timeout: 10 * time.Second}
+
+// withDefaults fills the fields missing from a backend's config with its
+// defaults.
+func withDefaults(name string, cfg config.Backend) config.Backend {
+	defaults, ok := defaultBackends[name]
+	if !ok {
+		defaults = fallbackBackend
+	}
+	if cfg.Rate == 0 {
+		cfg.Rate = defaults.Rate
+	}
+	if cfg.Burst == 0 {
+		cfg.Burst = defaults.Burst
+	}
+	if cfg.FailureThreshold == 0 {
+		cfg.FailureThreshold = defaults.FailureThreshold
+	}
+	if cfg.OpenTimeout == 0 {
+		cfg.OpenTimeout = defaults.OpenTimeout
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaults.Timeout
+	}
+	return cfg
+}
+
+// Backend guards calls to one external service with a rate limiter and a
+// circuit breaker.
+type Backend struct {
+	Name    string
+	limiter *TokenBucket
+	breaker *Breaker
+	timeout time.Duration
+}
+
+func NewBackend(name string, cfg config.Backend) *Backend {
+	return &Backend{
+		Name:    name,
+		limiter: NewTokenBucket(cfg.Rate, cfg.Burst),
+		breaker: NewBreaker(cfg.FailureThreshold, cfg.OpenTimeout),
+		timeout: cfg.Timeout,
+	}
+}
+
+var (
+	mu       sync.RWMutex
+	backends = map[string]*Backend{}
+)
+
+// Configure (re)creates the backends from the config, filling in defaults.
+func Configure(cfgs map[string]config.Backend) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	backends = map[string]*Backend{}
+	for name, cfg := range defaultBackends {
+		backends[name] = NewBackend(name, cfg)
+	}
+	for name, cfg := range cfgs {
+		backends[name] = NewBackend(name, withDefaults(name, cfg))
+	}
+}
+
+// Get returns the named backend, creating it with default settings if it was
+// not configured.
+func Get(name string) *Backend {
+	mu.RLock()
+	backend, ok := backends[name]
+	mu.RUnlock()
+	if ok {
+		return backend
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if backend, ok := backends[name]; ok {
+		return backend
+	}
+	backend = NewBackend(name, withDefaults(name, config.Backend{}))
+	backends[name] = backend
+	return backend
+}
+
+// Do sends the request unless the breaker is open or the rate limit is
+// reached, in which case it fails fast with an apperr.ErrUnavailable.
+// Transport errors, 429 and 5xx responses count as failures and are returned
+// as apperr.UpstreamError. The call, reading the body included, is cancelled
+// after the backend's timeout, so a hanging service counts as a failure too.
+func (b *Backend) Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	if ok, wait := b.breaker.Allow(); !ok {
+		if wait <= 0 {
+			wait = retryIn
+		}
+		return nil, apperr.Unavailable(b.Name, "%s is temporarily unavailable after repeated failures, retry in %s", b.Name, formatWait(wait))
+	}
+
+	if ok, wait := b.limiter.Allow(); !ok {
+		// the call did not happen, so do not count it either way
+		b.breaker.release()
+		return nil, apperr.Unavailable(b.Name, "rate limit for %s reached, retry in %s", b.Name, formatWait(wait))
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if b.timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(req.Context(), b.timeout)
+		req = req.WithContext(ctx)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		b.breaker.Failure()
+		log.Printf("%s: call failed: %v", b.Name, err)
+		return nil, apperr.Upstream(b.Name, 0, err)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		resp.Body.Close()
+		cancel()
+		b.breaker.Failure()
+		log.Printf("%s: unexpected status %d", b.Name, resp.StatusCode)
+		return nil, apperr.Upstream(b.Name, resp.StatusCode, fmt.Errorf("%s returned status %d", b.Name, resp.StatusCode))
+	}
+
+	b.breaker.Success()
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases the timeout of a call once its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// formatWait rounds a wait for display, keeping sub-second precision only
+// for short waits.
+func formatWait(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// BackendStatus describes a backend for the admin API.
+type BackendStatus struct {
+	Name            string        `json:"name"`
+	Breaker         BreakerStatus `json:"breaker"`
+	TokensAvailable float64       `json:"tokens_available"`
+}
+
+// Statuses returns the state of every backend, sorted by name.
+func Statuses() []BackendStatus {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	statuses := make([]BackendStatus, 0, len(backends))
+	for name, backend := range backends {
+		statuses = append(statuses, BackendStatus{
+			Name:            name,
+			Breaker:         backend.breaker.Status(),
+			TokensAvailable: backend.limiter.Tokens(),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
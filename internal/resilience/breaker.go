@@ -0,0 +1,119 @@
+package resilience
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half-open"
+)
+
+// Breaker is a circuit breaker. After threshold consecutive failures it
+// opens and rejects calls for openTimeout, then lets a single trial call
+// through; its outcome closes or re-opens the breaker.
+type Breaker struct {
+	mu          sync.Mutex
+	threshold   int
+	openTimeout time.Duration
+
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func NewBreaker(threshold int, openTimeout time.Duration) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Breaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		state:       StateClosed,
+	}
+}
+
+// Allow reports whether a call may proceed, and if not, how long until the
+// breaker lets a trial call through.
+func (b *Breaker) Allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		remaining := b.openTimeout - time.Since(b.openedAt)
+		if remaining > 0 {
+			return false, remaining
+		}
+		b.state = StateHalfOpen
+		b.trial = true
+		return true, 0
+	case StateHalfOpen:
+		// only one trial call at a time
+		if b.trial {
+			return false, 0
+		}
+		b.trial = true
+		return true, 0
+	default:
+		return true, 0
+	}
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = StateClosed
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trial = false
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		b.state = StateOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// release gives back a trial slot taken by Allow for a call that was not
+// made.
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+// BreakerStatus is a snapshot of a breaker for the admin API.
+type BreakerStatus struct {
+	State    string     `json:"state"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+	RetryIn  string     `json:"retry_in,omitempty"`
+}
+
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{State: b.state, Failures: b.failures}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	if b.state == StateOpen {
+		if remaining := b.openTimeout - time.Since(b.openedAt); remaining > 0 {
+			status.RetryIn = formatWait(remaining)
+		}
+	}
+	return status
+}
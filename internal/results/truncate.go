@@ -0,0 +1,186 @@
+package results
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// bytesPerToken is a rough estimate used to turn token limits into bytes.
+const bytesPerToken = 4
+
+// envelopeOverhead leaves room for the truncation note around the data.
+const envelopeOverhead = 512
+
+// Limit bounds the size of a tool result handed back to the model. Zero
+// values mean no limit.
+type Limit struct {
+	MaxBytes  int
+	MaxTokens int
+}
+
+// Bytes returns the effective byte limit, the stricter of the two limits.
+func (l Limit) Bytes() int {
+	max := l.MaxBytes
+	if tokens := l.MaxTokens * bytesPerToken; tokens > 0 && (max <= 0 || tokens < max) {
+		max = tokens
+	}
+	return max
+}
+
+// Partial wraps a result the model only sees part of, or a result that only
+// fits once its whitespace is dropped.
+type Partial struct {
+	Truncated     bool   `json:"truncated"`
+	Note          string `json:"note,omitempty"`
+	OriginalBytes int    `json:"original_bytes"`
+	Result        any    `json:"result,omitempty"`
+	Summary       string `json:"summary,omitempty"`
+}
+
+// Exceeds reports whether the encoded result is over the limit.
+func Exceeds(data []byte, limit Limit) bool {
+	max := limit.Bytes()
+	return max > 0 && len(data) > max
+}
+
+// Truncate shrinks an encoded result to fit the limit. Arrays are cut first,
+// largest first, keeping their leading items, so rows stay intact. If that is
+// not enough the JSON text itself is cut. The returned Partial tells the model
+// what was left out; when re-encoding without whitespace is enough, it is not
+// marked truncated and has no note.
+func Truncate(data []byte, limit Limit) *Partial {
+	budget := limit.Bytes() - envelopeOverhead
+	if budget < limit.Bytes()/2 {
+		budget = limit.Bytes() / 2
+	}
+	partial := &Partial{Truncated: true, OriginalBytes: len(data)}
+
+	var value any
+	if err := json.Unmarshal(data, &value); err == nil {
+		notes := trimArrays(&value, budget)
+
+		if encoded, err := json.Marshal(value); err == nil && len(encoded) <= budget {
+			partial.Result = value
+			if len(notes) == 0 {
+				// only whitespace was dropped, nothing is missing
+				partial.Truncated = false
+				return partial
+			}
+			partial.Note = "Partial data: " + strings.Join(notes, "; ") + "."
+			return partial
+		}
+	}
+
+	text := cutUTF8(string(data), budget)
+	partial.Result = text
+	partial.Note = fmt.Sprintf("Partial data: only the first %d of %d bytes of the result are shown.", len(text), len(data))
+	return partial
+}
+
+// arrayRef locates an array inside a decoded JSON value.
+type arrayRef struct {
+	path  string
+	items []any
+	set   func([]any)
+}
+
+// trimArrays repeatedly cuts the largest array until the value fits budget
+// or nothing is left to cut. It returns one note per trimmed array.
+func trimArrays(value *any, budget int) []string {
+	totals := map[string]int{}
+	kept := map[string]int{}
+
+	for {
+		encoded, err := json.Marshal(*value)
+		if err != nil || len(encoded) <= budget {
+			break
+		}
+
+		ref := largestArray(value)
+		if ref == nil {
+			break
+		}
+		if _, ok := totals[ref.path]; !ok {
+			totals[ref.path] = len(ref.items)
+		}
+
+		// keep as many leading items as fit, found by binary search
+		excess := len(encoded) - budget
+		lo, hi := 0, len(ref.items)-1
+		for lo < hi {
+			mid := (lo + hi + 1) / 2
+			if encodedSize(ref.items[mid:]) >= excess {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+		ref.set(ref.items[:lo])
+		kept[ref.path] = lo
+	}
+
+	paths := make([]string, 0, len(totals))
+	for path := range totals {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	notes := make([]string, 0, len(paths))
+	for _, path := range paths {
+		notes = append(notes, fmt.Sprintf("%s shows the first %d of %d items, %d left out", path, kept[path], totals[path], totals[path]-kept[path]))
+	}
+	return notes
+}
+
+func largestArray(root *any) *arrayRef {
+	var best *arrayRef
+	bestSize := 0
+
+	var walk func(v any, path string, set func([]any))
+	walk = func(v any, path string, set func([]any)) {
+		switch node := v.(type) {
+		case []any:
+			if len(node) > 0 {
+				if size := encodedSize(node); size > bestSize {
+					best, bestSize = &arrayRef{path: path, items: node, set: set}, size
+				}
+			}
+			for i, item := range node {
+				i := i
+				walk(item, fmt.Sprintf("%s[%d]", path, i), func(items []any) { node[i] = items })
+			}
+		case map[string]any:
+			for key, item := range node {
+				key := key
+				walk(item, path+"."+key, func(items []any) { node[key] = items })
+			}
+		}
+	}
+	walk(*root, "$", func(items []any) { *root = items })
+
+	return best
+}
+
+func encodedSize(v any) int {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+func cutUTF8(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,128 @@
+package retrieval
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters, the usual defaults.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Document is one entry of the index, e.g. a tool's name and description.
+type Document struct {
+	ID   string
+	Text string
+}
+
+// Result is a ranked document.
+type Result struct {
+	ID    string
+	Score float64
+}
+
+// Index ranks documents against a query with Okapi BM25. It is built once
+// and read only, so it is safe for concurrent use.
+type Index struct {
+	ids       []string
+	terms     []map[string]int
+	lengths   []int
+	avgLength float64
+	docFreq   map[string]int
+}
+
+func NewIndex(docs []Document) *Index {
+	idx := &Index{docFreq: make(map[string]int)}
+
+	total := 0
+	for _, doc := range docs {
+		terms := make(map[string]int)
+		tokens := Tokenize(doc.Text)
+		for _, token := range tokens {
+			terms[token]++
+		}
+		for term := range terms {
+			idx.docFreq[term]++
+		}
+
+		idx.ids = append(idx.ids, doc.ID)
+		idx.terms = append(idx.terms, terms)
+		idx.lengths = append(idx.lengths, len(tokens))
+		total += len(tokens)
+	}
+	if len(docs) > 0 {
+		idx.avgLength = float64(total) / float64(len(docs))
+	}
+
+	return idx
+}
+
+// Search returns up to k documents with a positive score, best first. Ties
+// keep index order.
+func (idx *Index) Search(query string, k int) []Result {
+	queryTerms := map[string]bool{}
+	for _, token := range Tokenize(query) {
+		queryTerms[token] = true
+	}
+
+	n := float64(len(idx.ids))
+	var results []Result
+	for i, terms := range idx.terms {
+		score := 0.0
+		for term := range queryTerms {
+			tf := float64(terms[term])
+			if tf == 0 {
+				continue
+			}
+			df := float64(idx.docFreq[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			norm := 1 - b + b*float64(idx.lengths[i])/idx.avgLength
+			score += idf * tf * (k1 + 1) / (tf + k1*norm)
+		}
+		if score > 0 {
+			results = append(results, Result{ID: idx.ids[i], Score: score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// Tokenize lowercases text and splits it on anything that is not a letter
+// or digit, so snake_case tool names become separate words. Stop words are
+// dropped and a trailing plural "s" is stripped.
+func Tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := fields[:0]
+	for _, field := range fields {
+		if stopWords[field] {
+			continue
+		}
+		if len(field) > 3 && strings.HasSuffix(field, "s") && !strings.HasSuffix(field, "ss") {
+			field = field[:len(field)-1]
+		}
+		tokens = append(tokens, field)
+	}
+	return tokens
+}
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "can": true, "do": true, "e": true, "for": true,
+	"from": true, "g": true, "get": true, "how": true, "i": true, "in": true,
+	"is": true, "it": true, "me": true, "my": true, "of": true, "on": true,
+	"or": true, "the": true, "this": true, "to": true, "was": true, "what": true,
+	"when": true, "which": true, "with": true, "you": true,
+}
@@ -0,0 +1,115 @@
+package revenueio
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"tempfunctiontools/internal/database"
+)
+
+// rateColumns are the columns of an exchange rate CSV. A row says one unit of
+// base is worth rate units of quote on date (YYYY-MM-DD).
+var rateColumns = []string{"date", "base", "quote", "rate"}
+
+// ParseRates reads and validates exchange rates from CSV. Like Parse, row
+// problems are reported per row and the error is only set when the input as
+// a whole cannot be read.
+func ParseRates(r io.Reader) ([]database.ExchangeRate, []RowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, fmt.Errorf("csv is empty")
+		}
+		return nil, nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range rateColumns {
+		if _, ok := index[name]; !ok {
+			return nil, nil, fmt.Errorf("csv header is missing the %s column", name)
+		}
+	}
+
+	rates := []database.ExchangeRate{}
+	rowErrors := []RowError{}
+	seen := map[string]int{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rowErrors = append(rowErrors, RowError{Row: parseErr.StartLine, Error: parseErr.Err.Error()})
+				continue
+			}
+			return nil, nil, fmt.Errorf("failed to read csv: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		field := func(name string) string {
+			if i := index[name]; i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		rate := database.ExchangeRate{Date: field("date"), Base: field("base"), Quote: field("quote")}
+		if rate.Rate, err = strconv.ParseFloat(field("rate"), 64); err != nil {
+			rowErrors = append(rowErrors, RowError{Row: line, Error: fmt.Sprintf("invalid rate %q", field("rate"))})
+			continue
+		}
+		if err := rate.Validate(); err != nil {
+			rowErrors = append(rowErrors, RowError{Row: line, Error: err.Error()})
+			continue
+		}
+		key := rate.Date + " " + rate.Base + "/" + rate.Quote
+		if first, exists := seen[key]; exists {
+			rowErrors = append(rowErrors, RowError{Row: line, Error: fmt.Sprintf("%s already appears in row %d", key, first)})
+			continue
+		}
+		seen[key] = line
+		rates = append(rates, rate)
+	}
+	return rates, rowErrors, nil
+}
+
+// LoadRates upserts the exchange rates of a CSV file. Any invalid row fails
+// the whole file.
+func LoadRates(ctx context.Context, db *database.DbConfig, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open exchange rates file: %w", err)
+	}
+	defer file.Close()
+
+	rates, rowErrors, err := ParseRates(file)
+	if err != nil {
+		return fmt.Errorf("failed to read exchange rates file %s: %w", path, err)
+	}
+	if len(rowErrors) > 0 {
+		return fmt.Errorf("exchange rates file %s row %d: %s", path, rowErrors[0].Row, rowErrors[0].Error)
+	}
+
+	if err := db.UpsertExchangeRates(ctx, rates); err != nil {
+		return err
+	}
+
+	log.Printf("loaded %d exchange rates from %s", len(rates), path)
+	return nil
+}
@@ -0,0 +1,323 @@
+// Package revenueio reads and writes revenue rows as CSV or JSON.
+package revenueio
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"tempfunctiontools/internal/database"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// csvColumns is the column order written by the CSV export. The currency and
+// dimension columns are optional on import.
+var csvColumns = []string{"month", "year", "amount", "currency", database.DimRegion, database.DimProductLine, database.DimChannel}
+
+// requiredColumns must be present in an imported CSV header.
+var requiredColumns = csvColumns[:3]
+
+// Row is one parsed input row. Number is the CSV line or the 1-based
+// position in the JSON array.
+type Row struct {
+	Number  int
+	Revenue database.Revenue
+	Err     error
+}
+
+// RowError reports an invalid input row.
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// FormatOf picks the format from a file name's extension.
+func FormatOf(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".json":
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("unsupported file type %q, use .csv or .json", filepath.Ext(path))
+	}
+}
+
+// Parse reads every row and validates it. Row problems, including months
+// that appear twice, are reported on the row; the error is only set when
+// the input as a whole cannot be read.
+func Parse(r io.Reader, format string) ([]Row, error) {
+	var rows []Row
+	var err error
+	switch format {
+	case FormatCSV:
+		rows, err = parseCSV(r)
+	case FormatJSON:
+		rows, err = parseJSON(r)
+	default:
+		return nil, fmt.Errorf("unsupported format %q, use csv or json", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[database.RevenueKey]int, len(rows))
+	for i := range rows {
+		row := &rows[i]
+		if row.Err != nil {
+			continue
+		}
+		if row.Err = row.Revenue.Validate(); row.Err != nil {
+			continue
+		}
+		key := row.Revenue.Key()
+		if first, exists := seen[key]; exists {
+			row.Err = fmt.Errorf("%s already appears in row %d", key, first)
+			continue
+		}
+		seen[key] = row.Number
+	}
+	return rows, nil
+}
+
+// Split separates the valid revenues from the row errors.
+func Split(rows []Row) ([]database.Revenue, []RowError) {
+	revenues := make([]database.Revenue, 0, len(rows))
+	rowErrors := []RowError{}
+	for _, row := range rows {
+		if row.Err != nil {
+			rowErrors = append(rowErrors, RowError{Row: row.Number, Error: row.Err.Error()})
+			continue
+		}
+		revenues = append(revenues, row.Revenue)
+	}
+	return revenues, rowErrors
+}
+
+func parseCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("csv is empty")
+		}
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range requiredColumns {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("csv header is missing the %s column", name)
+		}
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rows = append(rows, Row{Number: parseErr.StartLine, Err: parseErr.Err})
+				continue
+			}
+			return nil, fmt.Errorf("failed to read csv: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := Row{Number: line}
+		field := func(name string) string {
+			if i, ok := index[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row.Revenue, row.Err = revenueFromFields(field("month"), field("year"), field("amount"))
+		row.Revenue.Currency = database.CurrencyOrDefault(field("currency"))
+		row.Revenue.Region = field(database.DimRegion)
+		row.Revenue.ProductLine = field(database.DimProductLine)
+		row.Revenue.Channel = field(database.DimChannel)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func revenueFromFields(month, year, amount string) (database.Revenue, error) {
+	var revenue database.Revenue
+	var err error
+	if revenue.Month, err = strconv.Atoi(month); err != nil {
+		return revenue, fmt.Errorf("invalid month %q", month)
+	}
+	if revenue.Year, err = strconv.Atoi(year); err != nil {
+		return revenue, fmt.Errorf("invalid year %q", year)
+	}
+	if revenue.Amount, err = strconv.ParseFloat(amount, 64); err != nil {
+		return revenue, fmt.Errorf("invalid amount %q", amount)
+	}
+	return revenue, nil
+}
+
+// jsonRow uses pointers to tell missing fields from zero values.
+type jsonRow struct {
+	Month  *int     `json:"month"`
+	Year   *int     `json:"year"`
+	Amount *float64 `json:"amount"`
+
+	Currency    string `json:"currency"`
+	Region      string `json:"region"`
+	ProductLine string `json:"product_line"`
+	Channel     string `json:"channel"`
+}
+
+// parseJSON reads a JSON array of {"month", "year", "amount"} objects, with
+// optional currency and dimensions, one element at a time.
+func parseJSON(r io.Reader) ([]Row, error) {
+	decoder := json.NewDecoder(r)
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read json: %w", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("json must be an array of revenues")
+	}
+
+	var rows []Row
+	for number := 1; decoder.More(); number++ {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("failed to read json element %d: %w", number, err)
+		}
+
+		row := Row{Number: number}
+		var value jsonRow
+		switch err := json.Unmarshal(raw, &value); {
+		case err != nil:
+			row.Err = fmt.Errorf("invalid revenue: %v", err)
+		case value.Month == nil:
+			row.Err = fmt.Errorf("month is required")
+		case value.Year == nil:
+			row.Err = fmt.Errorf("year is required")
+		case value.Amount == nil:
+			row.Err = fmt.Errorf("amount is required")
+		default:
+			row.Revenue = database.Revenue{
+				Month:       *value.Month,
+				Year:        *value.Year,
+				Amount:      *value.Amount,
+				Currency:    database.CurrencyOrDefault(value.Currency),
+				Region:      strings.TrimSpace(value.Region),
+				ProductLine: strings.TrimSpace(value.ProductLine),
+				Channel:     strings.TrimSpace(value.Channel),
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("failed to read json: %w", err)
+	}
+	return rows, nil
+}
+
+// Writer streams revenues in one format. Close finishes the document.
+type Writer interface {
+	Write(revenue database.Revenue) error
+	Close() error
+}
+
+// NewWriter returns a streaming writer for the format. Nothing is written to
+// w before the first Write or Close.
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case FormatJSON:
+		return &jsonWriter{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q, use csv or json", format)
+	}
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	started bool
+}
+
+func (cw *csvWriter) header() error {
+	if cw.started {
+		return nil
+	}
+	cw.started = true
+	return cw.w.Write(csvColumns)
+}
+
+func (cw *csvWriter) Write(revenue database.Revenue) error {
+	if err := cw.header(); err != nil {
+		return err
+	}
+	return cw.w.Write([]string{
+		strconv.Itoa(revenue.Month),
+		strconv.Itoa(revenue.Year),
+		strconv.FormatFloat(revenue.Amount, 'f', -1, 64),
+		revenue.Currency,
+		revenue.Region,
+		revenue.ProductLine,
+		revenue.Channel,
+	})
+}
+
+func (cw *csvWriter) Close() error {
+	if err := cw.header(); err != nil {
+		return err
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// jsonWriter writes a JSON array element by element.
+type jsonWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (jw *jsonWriter) Write(revenue database.Revenue) error {
+	prefix := ","
+	if jw.count == 0 {
+		prefix = "["
+	}
+	jw.count++
+
+	data, err := json.Marshal(revenue)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(jw.w, prefix+string(data)+"\n")
+	return err
+}
+
+func (jw *jsonWriter) Close() error {
+	end := "]\n"
+	if jw.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(jw.w, end)
+	return err
+}
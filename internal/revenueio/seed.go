@@ -0,0 +1,43 @@
+package revenueio
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"tempfunctiontools/internal/database"
+)
+
+// Seed loads a CSV or JSON seed file, inserting only the months that have no
+// revenue yet so edits made since the last start are kept. Any invalid row
+// fails the whole seed.
+func Seed(ctx context.Context, db *database.DbConfig, path string) error {
+	format, err := FormatOf(path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open seed file: %w", err)
+	}
+	defer file.Close()
+
+	rows, err := Parse(file, format)
+	if err != nil {
+		return fmt.Errorf("failed to read seed file %s: %w", path, err)
+	}
+	revenues, rowErrors := Split(rows)
+	if len(rowErrors) > 0 {
+		return fmt.Errorf("seed file %s row %d: %s", path, rowErrors[0].Row, rowErrors[0].Error)
+	}
+
+	inserted, err := db.InsertMissingRevenues(ctx, revenues)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("seeded %d of %d revenues from %s", inserted, len(revenues), path)
+	return nil
+}
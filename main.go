@@ -2,11 +2,21 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
+	"os"
 
 	"tempfunctiontools/controllers"
 
+	"tempfunctiontools/internal/cache"
+	"tempfunctiontools/internal/config"
 	"tempfunctiontools/internal/database"
+	"tempfunctiontools/internal/declarative"
+	"tempfunctiontools/internal/functions"
+	"tempfunctiontools/internal/mcp"
+	"tempfunctiontools/internal/openapi"
+	"tempfunctiontools/internal/resilience"
+	"tempfunctiontools/internal/revenueio"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,24 +26,138 @@ const (
 )
 
 func main() {
+	mcpStdio := flag.Bool("mcp-stdio", false, "serve the registered tools over MCP on stdin/stdout instead of starting the HTTP server")
+	flag.Parse()
+
 	log.SetFlags(log.Ldate | log.Lshortfile | log.LstdFlags)
-	router := gin.Default()
 
 	ctx := context.Background()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	// rate limits and circuit breakers for wttr.in and ip-api.com
+	resilience.Configure(cfg.Backends)
+	functions.ConfigureLocationCache(cfg.Cache.LocationTTL)
+
 	dbConfig := database.DbConfig{}
-	dbConfig.InitDb()
+	dbOptions := database.Options{
+		Dialect:         cfg.Database.Dialect,
+		DSN:             os.ExpandEnv(cfg.Database.DSN),
+		AutoMigrate:     cfg.Database.AutoMigrate,
+		MaxOpenConns:    cfg.Database.MaxOpenConns,
+		MaxIdleConns:    cfg.Database.MaxIdleConns,
+		ConnMaxLifetime: cfg.Database.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.Database.ConnMaxIdleTime,
+	}
+
+	// migrate up|down|status
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(ctx, &dbConfig, dbOptions, flag.Args()[1:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
+	if err := dbConfig.InitDb(dbOptions); err != nil {
+		log.Fatalf("failed to initialize database: %v", err)
+	}
+
+	if cfg.Database.SeedFile != "" {
+		if err := revenueio.Seed(ctx, &dbConfig, cfg.Database.SeedFile); err != nil {
+			log.Fatalf("failed to seed revenues: %v", err)
+		}
+	}
+	if cfg.Database.ExchangeRatesFile != "" {
+		if err := revenueio.LoadRates(ctx, &dbConfig, cfg.Database.ExchangeRatesFile); err != nil {
+			log.Fatalf("failed to load exchange rates: %v", err)
+		}
+	}
 
 	agent := controllers.NewAgent(systemMsg, 3, &dbConfig)
 
-	ctrl := controllers.NewChatController(ctx, agent, &dbConfig)
+	ctrl := controllers.NewChatController(ctx, agent, &dbConfig, cfg)
+
+	// tools declared in the config file
+	declarative.RegisterTools(agent, cfg.Tools)
+
+	// import HTTP tools from OpenAPI specs
+	openapi.RegisterTools(agent, cfg.OpenAPI)
+
+	// import tools from external MCP servers
+	mcpClients := mcp.RegisterTools(ctx, agent, cfg.MCPServers)
+
+	// old tool names mapped to current tools
+	declarative.RegisterAliases(agent, cfg.Aliases)
+
+	for _, name := range cfg.RequireApproval {
+		if err := agent.Tools.RequireApproval(name); err != nil {
+			log.Printf("require_approval: %v", err)
+		}
+	}
+
+	// cache tool results, dropping revenue entries when revenue rows change
+	cacheBackend := cache.NewBackend(cfg.Cache, &dbConfig)
+	cache.Apply(agent.Tools, cfg.Cache, cacheBackend, &dbConfig)
+
+	mcpServer := mcp.NewServer(agent)
+	toolCtrl := controllers.NewToolController(agent)
+	revenueCtrl := controllers.NewRevenueController(&dbConfig)
+
+	if *mcpStdio {
+		// stdout carries the protocol, logs keep going to stderr
+		if err := mcpServer.ServeStdio(ctx, os.Stdin, os.Stdout); err != nil {
+			log.Printf("mcp: stdio server stopped: %v", err)
+		}
+	} else {
+		router := gin.Default()
+
+		router.POST("/api/chat", ctrl.GetChat)
+		router.POST("/api/chat/runs/:id/approve", ctrl.ApproveToolCall)
+		router.POST("/api/chat/runs/:id/reject", ctrl.RejectToolCall)
+		router.GET("/api/revenue/:quarter/:year", ctrl.GetQuarterlyRevenue)
+		// v2 adds currency, months and per-group totals to the quarter
+		router.GET("/api/v2/revenue/:quarter/:year", ctrl.GetQuarterlyRevenueV2)
+		// router.GET("/api/revenue/:month/:year", ctrl.GetRevenue)
+
+		// revenue maintenance
+		router.POST("/api/revenue", revenueCtrl.CreateRevenue)
+		router.POST("/api/revenue/bulk", revenueCtrl.BulkUpsertRevenue)
+		router.POST("/api/revenue/import", revenueCtrl.ImportRevenue)
+		router.GET("/api/revenue/export", revenueCtrl.ExportRevenue)
+		router.GET("/api/revenue/summary", revenueCtrl.GetRevenueSummary)
+		router.PUT("/api/revenue/:year/:month", revenueCtrl.UpdateRevenue)
+		router.DELETE("/api/revenue/:year/:month", revenueCtrl.DeleteRevenue)
+		router.GET("/api/exchange-rates", revenueCtrl.ListExchangeRates)
+		router.POST("/api/exchange-rates/import", revenueCtrl.ImportExchangeRates)
+
+		// tool registry admin
+		router.GET("/api/tools", toolCtrl.ListTools)
+		router.GET("/api/tools/examples", toolCtrl.ListExamples)
 
-	router.POST("/api/chat", ctrl.GetChat)
-	router.GET("/api/revenue/:quarter/:year", ctrl.GetQuarterlyRevenue)
-	// router.GET("/api/revenue/:month/:year", ctrl.GetRevenue)
+		// running and toggling tools and reading the audit log need the
+		// admin token
+		admin := router.Group("/api", controllers.RequireAdmin(os.ExpandEnv(cfg.Admin.Token)))
+		admin.POST("/tools/:name/invoke", toolCtrl.InvokeTool)
+		admin.POST("/tools/:name/enable", toolCtrl.EnableTool)
+		admin.POST("/tools/:name/disable", toolCtrl.DisableTool)
+		admin.GET("/backends", toolCtrl.ListBackends)
+		admin.GET("/tool-calls", toolCtrl.ListToolCalls)
 
-	// Define a new route for ProcessQuery
+		// MCP streamable HTTP transport, only with a token to check
+		if token := os.ExpandEnv(cfg.MCP.Token); token != "" {
+			router.Any("/mcp", gin.WrapH(mcp.Guard(mcpServer, token, cfg.MCP.AllowedOrigins)))
+		} else {
+			log.Printf("mcp: no mcp.token set, not serving /mcp")
+		}
 
-	router.Run(":8080")
+		router.Run(":8080")
+	}
 
+	for _, client := range mcpClients {
+		client.Close()
+	}
 	dbConfig.Close()
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"tempfunctiontools/internal/database"
+)
+
+const migrateUsage = "usage: migrate up|down|status"
+
+// runMigrate runs the migrate command: up applies pending migrations, down
+// rolls back the last group and status lists every migration.
+func runMigrate(ctx context.Context, db *database.DbConfig, opts database.Options, args []string) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	if err := db.Open(opts); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		group, err := db.Migrate(ctx)
+		if err != nil {
+			return err
+		}
+		if group.IsZero() {
+			fmt.Println("no pending migrations")
+			return nil
+		}
+		fmt.Printf("applied %s\n", group)
+
+	case "down", "rollback":
+		group, err := db.Rollback(ctx)
+		if err != nil {
+			return err
+		}
+		if group.IsZero() {
+			fmt.Println("no migrations to roll back")
+			return nil
+		}
+		fmt.Printf("rolled back %s\n", group)
+
+	case "status":
+		ms, err := db.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MIGRATION\tSTATUS\tGROUP\tMIGRATED AT")
+		for _, m := range ms {
+			if !m.IsApplied() {
+				fmt.Fprintf(w, "%s\tpending\t\t\n", m)
+				continue
+			}
+			fmt.Fprintf(w, "%s\tapplied\t%d\t%s\n", m, m.GroupID, m.MigratedAt.Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+		fmt.Printf("%d applied, %d pending\n", len(ms.Applied()), len(ms.Unapplied()))
+
+	default:
+		return fmt.Errorf("unknown command %q, %s", args[0], migrateUsage)
+	}
+	return nil
+}
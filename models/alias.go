@@ -0,0 +1,18 @@
+package models
+
+// Alias maps an old tool name to a current tool, so renaming or reshaping a
+// tool does not break prompts and models that still use the old name.
+type Alias struct {
+	Name   string
+	Target string
+	// Version pins the alias to one registered version of the target. Zero
+	// means the current version.
+	Version int
+	// Adapt reshapes the caller's arguments into what the target expects.
+	// Nil passes them through unchanged.
+	Adapt func(args map[string]any) (map[string]any, error)
+	// Deprecated logs a warning every time the alias is called.
+	Deprecated bool
+	// Note is appended to the deprecation warning, e.g. what changed.
+	Note string
+}
@@ -0,0 +1,38 @@
+package models
+
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+
+	RunStatusPendingApproval = "pending_approval"
+)
+
+// ProposedCall is a tool call the model made, as shown to a reviewer.
+type ProposedCall struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+	// RequiresApproval is false for calls that will run without review once
+	// the run continues.
+	RequiresApproval bool   `json:"requires_approval"`
+	Status           string `json:"status,omitempty"`
+	Reason           string `json:"reason,omitempty"`
+}
+
+// PendingApproval is returned instead of the final messages when the model
+// called a tool that requires approval. The run continues once every call
+// requiring approval has been approved or rejected.
+type PendingApproval struct {
+	RunID     string         `json:"run_id"`
+	Status    string         `json:"status"`
+	Messages  []Message      `json:"messages"`
+	ToolCalls []ProposedCall `json:"tool_calls"`
+}
+
+// ApprovalDecision is the body of the approve and reject endpoints. An empty
+// ToolCallID applies the decision to every pending call of the run.
+type ApprovalDecision struct {
+	ToolCallID string `json:"tool_call_id"`
+	Reason     string `json:"reason"`
+}
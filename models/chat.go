@@ -1,6 +1,11 @@
 package models
 
-import "tempfunctiontools/internal/database"
+import (
+	"context"
+
+	"tempfunctiontools/internal/audit"
+	"tempfunctiontools/internal/database"
+)
 
 // Chat message role defined by the OpenAI API.
 const (
@@ -72,15 +77,25 @@ type UserResponse struct {
 //     "name": "
 
 type Tool struct {
-	Function *Function                              `json:"function"`
-	Type     string                                 `json:"type"`
-	Execute  func(args map[string]any) (any, error) `json:"-"`
+	Function *Function `json:"function"`
+	Type     string    `json:"type"`
+	// Execute runs the tool. ctx is the caller's, so it carries its
+	// cancellation, audit IDs and approval.
+	Execute func(ctx context.Context, args map[string]any) (any, error) `json:"-"`
+	// RequiresApproval holds calls to the tool until a reviewer approves them.
+	RequiresApproval bool `json:"-"`
+	// Version distinguishes definitions registered under the same name; the
+	// highest is offered to the model. Zero means unversioned.
+	Version int `json:"-"`
 }
 
 type Function struct {
 	Name        string      `json:"name"`
 	Description string      `json:"description"`
 	Parameters  *Parameters `json:"parameters,omitempty"`
+	// Examples are rendered into the description or the system prompt
+	// before the request is sent, never as a field of their own.
+	Examples []Example `json:"-"`
 }
 
 type Parameters struct {
@@ -93,11 +108,24 @@ type Parameter struct {
 	Type        string   `json:"type,omitempty"`
 	Description string   `json:"description,omitempty"`
 	Enum        []string `json:"enum,omitempty"`
+
+	// nested schemas for array and object parameters
+	Items      *Parameter            `json:"items,omitempty"`
+	Properties map[string]*Parameter `json:"properties,omitempty"`
+	Required   []string              `json:"required,omitempty"`
 }
 
 type Agent struct {
-	Tools      map[string]Tool
+	Tools      *ToolRegistry
 	SystemMsg  string
 	MaxRetries int
 	Db         *database.DbConfig
+	// Audit records every tool call, nil disables it.
+	Audit *audit.Logger
+}
+
+// ToolList returns the enabled tools sorted by name, in the form sent to the
+// LLM.
+func (a *Agent) ToolList() []Tool {
+	return a.Tools.Enabled()
 }
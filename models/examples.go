@@ -0,0 +1,124 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Example is a sample user query with the tool calls that answer it. It
+// steers the model away from common mistakes and doubles as an evaluation
+// case.
+type Example struct {
+	Query string        `json:"query" yaml:"query"`
+	Calls []ExampleCall `json:"calls" yaml:"calls"`
+	// Note explains the example, e.g. why a quarter takes three calls.
+	Note string `json:"note,omitempty" yaml:"note"`
+}
+
+// ExampleCall is one expected tool call. Name defaults to the tool the
+// example is attached to.
+type ExampleCall struct {
+	Name      string         `json:"name,omitempty" yaml:"name"`
+	Arguments map[string]any `json:"arguments" yaml:"arguments"`
+}
+
+// EvalCase is an example in the form an evaluation harness consumes: the
+// query to send and the tool calls the model is expected to make.
+type EvalCase struct {
+	Tool          string        `json:"tool"`
+	Query         string        `json:"query"`
+	ExpectedCalls []ExampleCall `json:"expected_calls"`
+	Note          string        `json:"note,omitempty"`
+}
+
+// Example placements.
+const (
+	ExamplesInDescription = "description"
+	ExamplesInSystem      = "system"
+	ExamplesNone          = "none"
+)
+
+// RenderExamples formats a function's examples as plain text, one query per
+// line followed by its calls.
+func RenderExamples(fn *Function) string {
+	if fn == nil || len(fn.Examples) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, example := range fn.Examples {
+		fmt.Fprintf(&sb, "- %q ->", example.Query)
+		for i, call := range example.Calls {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			name := call.Name
+			if name == "" {
+				name = fn.Name
+			}
+			args, _ := json.Marshal(call.Arguments)
+			fmt.Fprintf(&sb, " %s(%s)", name, args)
+		}
+		if example.Note != "" {
+			fmt.Fprintf(&sb, " (%s)", example.Note)
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// WithExamplesInDescription returns a copy of the tool with its examples
+// appended to the description. The registered tool is not changed.
+func (t Tool) WithExamplesInDescription() Tool {
+	rendered := RenderExamples(t.Function)
+	if rendered == "" {
+		return t
+	}
+
+	fn := *t.Function
+	fn.Description = strings.TrimSpace(fn.Description + "\n\nExamples:\n" + rendered)
+	t.Function = &fn
+	return t
+}
+
+// ExamplesPrompt renders the examples of every tool as a system prompt
+// section. It returns an empty string when no tool has examples.
+func ExamplesPrompt(tools []Tool) string {
+	var sections []string
+	for _, tool := range tools {
+		if rendered := RenderExamples(tool.Function); rendered != "" {
+			sections = append(sections, "Examples for "+tool.Function.Name+":\n"+rendered)
+		}
+	}
+	if len(sections) == 0 {
+		return ""
+	}
+	return "Tool usage examples:\n\n" + strings.Join(sections, "\n\n")
+}
+
+// EvalCases turns the examples of the given tools into evaluation cases.
+func EvalCases(tools []Tool) []EvalCase {
+	cases := []EvalCase{}
+	for _, tool := range tools {
+		if tool.Function == nil {
+			continue
+		}
+		for _, example := range tool.Function.Examples {
+			calls := make([]ExampleCall, 0, len(example.Calls))
+			for _, call := range example.Calls {
+				if call.Name == "" {
+					call.Name = tool.Function.Name
+				}
+				calls = append(calls, call)
+			}
+			cases = append(cases, EvalCase{
+				Tool:          tool.Function.Name,
+				Query:         example.Query,
+				ExpectedCalls: calls,
+				Note:          example.Note,
+			})
+		}
+	}
+	return cases
+}
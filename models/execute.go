@@ -0,0 +1,83 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"tempfunctiontools/internal/apperr"
+	"tempfunctiontools/internal/audit"
+)
+
+// CallTool runs a tool call by name or alias and records it in the audit log,
+// whether it comes from a chat run, MCP or the admin API. approved says
+// whether a reviewer approved the call; tools that require approval are
+// refused without it.
+func (a *Agent) CallTool(ctx context.Context, call ToolCall, approved bool) (any, error) {
+	started := time.Now()
+	result, err := a.callTool(ctx, call, approved)
+
+	entry := audit.Entry{Err: err, Started: started}
+	if err == nil {
+		if data, marshalErr := json.Marshal(result); marshalErr == nil {
+			entry.Result = string(data)
+		}
+	}
+	a.Audit.Record(ctx, a.AuditEntry(call, entry))
+	return result, err
+}
+
+func (a *Agent) callTool(ctx context.Context, call ToolCall, approved bool) (any, error) {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+		return nil, apperr.Invalid("arguments", "arguments are not a JSON object: %v", err)
+	}
+	if args == nil {
+		args = map[string]any{}
+	}
+
+	get := a.Tools.GetUnapproved
+	if approved {
+		get = a.Tools.Get
+	}
+	tool, err := get(call.Function.Name)
+	if err != nil {
+		return nil, err
+	}
+	return tool.Execute(context.WithValue(ctx, approvedKey{}, approved), args)
+}
+
+type approvedKey struct{}
+
+// Approved reports whether the tool call running with ctx was approved by a
+// reviewer, so that tools calling other tools can pass the approval on.
+func Approved(ctx context.Context) bool {
+	approved, _ := ctx.Value(approvedKey{}).(bool)
+	return approved
+}
+
+// AuditEntry fills in the call details of an audit entry. Calls made through
+// an alias are recorded under the tool they resolve to.
+func (a *Agent) AuditEntry(call ToolCall, entry audit.Entry) audit.Entry {
+	entry.ToolCallID = call.Id
+	entry.Arguments = call.Function.Arguments
+	entry.ToolName = call.Function.Name
+	if target, isAlias := a.Tools.Resolve(call.Function.Name); isAlias {
+		entry.ToolName = target
+		entry.CalledAs = call.Function.Name
+	}
+	return entry
+}
+
+// NewToolCall returns a call of a tool with arguments, for callers that do
+// not get the call from the LLM.
+func NewToolCall(id, name string, args map[string]any) (ToolCall, error) {
+	arguments, err := json.Marshal(args)
+	if err != nil {
+		return ToolCall{}, apperr.Invalid("arguments", "arguments cannot be encoded: %v", err)
+	}
+	call := ToolCall{Id: id, Type: "function"}
+	call.Function.Name = name
+	call.Function.Arguments = string(arguments)
+	return call, nil
+}
@@ -0,0 +1,298 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"tempfunctiontools/internal/apperr"
+)
+
+// ToolRegistry holds the agent's tools. It is safe for concurrent use, so
+// tools can be registered, enabled or disabled while chats are in flight.
+//
+// Every registered version of a tool is kept; the highest one is current and
+// is the one listed to the model. Aliases resolve old names to a current tool
+// or a pinned version.
+type ToolRegistry struct {
+	mu       sync.RWMutex
+	tools    map[string]Tool
+	versions map[string]map[int]Tool
+	aliases  map[string]Alias
+	disabled map[string]bool
+}
+
+// ToolStatus describes a registered tool for the admin API.
+type ToolStatus struct {
+	Name             string      `json:"name"`
+	Description      string      `json:"description"`
+	Parameters       *Parameters `json:"parameters,omitempty"`
+	Version          int         `json:"version,omitempty"`
+	Versions         []int       `json:"versions,omitempty"`
+	Aliases          []string    `json:"aliases,omitempty"`
+	Examples         []Example   `json:"examples,omitempty"`
+	Enabled          bool        `json:"enabled"`
+	RequiresApproval bool        `json:"requires_approval"`
+}
+
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{
+		tools:    make(map[string]Tool),
+		versions: make(map[string]map[int]Tool),
+		aliases:  make(map[string]Alias),
+		disabled: make(map[string]bool),
+	}
+}
+
+// Register adds a tool. A tool with a higher Version than the registered one
+// becomes current, the older versions stay available to pinned aliases. It
+// returns false if the same name and version, or an alias with that name, is
+// already registered.
+func (r *ToolRegistry) Register(tool Tool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := tool.Function.Name
+	if _, isAlias := r.aliases[name]; isAlias {
+		return false
+	}
+	versions := r.versions[name]
+	if _, exists := versions[tool.Version]; exists {
+		return false
+	}
+	if versions == nil {
+		versions = make(map[int]Tool)
+		r.versions[name] = versions
+	}
+	versions[tool.Version] = tool
+
+	current, exists := r.tools[name]
+	if !exists || tool.Version > current.Version {
+		tool.RequiresApproval = tool.RequiresApproval || current.RequiresApproval
+		r.tools[name] = tool
+	}
+	return true
+}
+
+// RegisterAlias adds an alias. The target does not have to be registered
+// yet; it is looked up on every call.
+func (r *ToolRegistry) RegisterAlias(alias Alias) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if alias.Name == alias.Target {
+		return fmt.Errorf("alias %s points to itself", alias.Name)
+	}
+	if _, exists := r.tools[alias.Name]; exists {
+		return fmt.Errorf("alias %s conflicts with a registered tool", alias.Name)
+	}
+	if _, exists := r.aliases[alias.Name]; exists {
+		return fmt.Errorf("alias %s is already registered", alias.Name)
+	}
+	r.aliases[alias.Name] = alias
+	return nil
+}
+
+// Resolve returns the name of the tool a name refers to and whether the name
+// is an alias.
+func (r *ToolRegistry) Resolve(name string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if alias, ok := r.aliases[name]; ok {
+		return alias.Target, true
+	}
+	return name, false
+}
+
+// Get returns an enabled tool by name or alias. A tool returned for an alias
+// adapts its arguments and warns when the alias is deprecated.
+func (r *ToolRegistry) Get(name string) (Tool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if alias, ok := r.aliases[name]; ok {
+		return r.resolveAlias(alias)
+	}
+	return r.get(name)
+}
+
+// GetUnapproved returns an enabled tool for a call no reviewer approves, such
+// as one made over MCP or the admin API. Tools that require approval only run
+// in chat runs, which hold them for a reviewer, so they are refused with
+// ErrConflict.
+func (r *ToolRegistry) GetUnapproved(name string) (Tool, error) {
+	tool, err := r.Get(name)
+	if err != nil {
+		return Tool{}, err
+	}
+	if tool.RequiresApproval {
+		return Tool{}, apperr.Errorf(apperr.ErrConflict, "tool %s requires approval and can only be called in a chat", name)
+	}
+	return tool, nil
+}
+
+// get returns an enabled tool. The caller holds the lock.
+func (r *ToolRegistry) get(name string) (Tool, error) {
+	tool, exists := r.tools[name]
+	if !exists {
+		return Tool{}, apperr.Errorf(apperr.ErrNotFound, "tool %s not found", name)
+	}
+	if r.disabled[name] {
+		return Tool{}, apperr.Errorf(apperr.ErrConflict, "tool %s is disabled", name)
+	}
+	return tool, nil
+}
+
+// resolveAlias returns the alias target with its Execute wrapped. A disabled
+// target disables the alias too, and a pinned version keeps the approval
+// requirement of the current one. The caller holds the lock.
+func (r *ToolRegistry) resolveAlias(alias Alias) (Tool, error) {
+	tool, err := r.get(alias.Target)
+	if err != nil {
+		return Tool{}, fmt.Errorf("alias %s: %w", alias.Name, err)
+	}
+	if alias.Version != 0 && alias.Version != tool.Version {
+		pinned, exists := r.versions[alias.Target][alias.Version]
+		if !exists {
+			return Tool{}, apperr.Errorf(apperr.ErrNotFound, "alias %s: tool %s has no version %d", alias.Name, alias.Target, alias.Version)
+		}
+		pinned.RequiresApproval = pinned.RequiresApproval || tool.RequiresApproval
+		tool = pinned
+	}
+
+	execute := tool.Execute
+	tool.Execute = func(ctx context.Context, args map[string]any) (any, error) {
+		if alias.Deprecated {
+			message := fmt.Sprintf("warning: deprecated tool name %s called, use %s instead", alias.Name, alias.Target)
+			if alias.Note != "" {
+				message += ": " + alias.Note
+			}
+			log.Print(message)
+		}
+		if alias.Adapt != nil {
+			adapted, err := alias.Adapt(args)
+			if err != nil {
+				return nil, fmt.Errorf("alias %s: %w", alias.Name, err)
+			}
+			args = adapted
+		}
+		return execute(ctx, args)
+	}
+	return tool, nil
+}
+
+// Has reports whether a tool or alias is registered, enabled or not.
+func (r *ToolRegistry) Has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, exists := r.tools[name]
+	_, isAlias := r.aliases[name]
+	return exists || isAlias
+}
+
+// Enabled returns the enabled tools sorted by name.
+func (r *ToolRegistry) Enabled() []Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tools := make([]Tool, 0, len(r.tools))
+	for name, tool := range r.tools {
+		if !r.disabled[name] {
+			tools = append(tools, tool)
+		}
+	}
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].Function.Name < tools[j].Function.Name
+	})
+	return tools
+}
+
+// Statuses returns every registered tool with its status, sorted by name.
+func (r *ToolRegistry) Statuses() []ToolStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	aliases := make(map[string][]string)
+	for name, alias := range r.aliases {
+		aliases[alias.Target] = append(aliases[alias.Target], name)
+	}
+
+	statuses := make([]ToolStatus, 0, len(r.tools))
+	for name, tool := range r.tools {
+		status := ToolStatus{
+			Name:             name,
+			Description:      tool.Function.Description,
+			Parameters:       tool.Function.Parameters,
+			Version:          tool.Version,
+			Aliases:          aliases[name],
+			Examples:         tool.Function.Examples,
+			Enabled:          !r.disabled[name],
+			RequiresApproval: tool.RequiresApproval,
+		}
+		sort.Strings(status.Aliases)
+		if len(r.versions[name]) > 1 {
+			for version := range r.versions[name] {
+				status.Versions = append(status.Versions, version)
+			}
+			sort.Ints(status.Versions)
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// SetEnabled enables or disables a tool. The change applies to the next
+// request that lists or calls tools.
+func (r *ToolRegistry) SetEnabled(name string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tools[name]; !exists {
+		return apperr.Errorf(apperr.ErrNotFound, "tool %s not found", name)
+	}
+	if enabled {
+		delete(r.disabled, name)
+	} else {
+		r.disabled[name] = true
+	}
+	return nil
+}
+
+// RequireApproval flags a registered tool as requiring human approval.
+func (r *ToolRegistry) RequireApproval(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tool, exists := r.tools[name]
+	if !exists {
+		return apperr.Errorf(apperr.ErrNotFound, "tool %s not found", name)
+	}
+	tool.RequiresApproval = true
+	r.tools[name] = tool
+	return nil
+}
+
+// Wrap replaces a registered tool and each of its versions with the result
+// of fn, e.g. to add caching around its Execute function, so that aliases
+// pinned to an older version are wrapped too.
+func (r *ToolRegistry) Wrap(name string, fn func(Tool) Tool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tool, exists := r.tools[name]
+	if !exists {
+		return apperr.Errorf(apperr.ErrNotFound, "tool %s not found", name)
+	}
+	r.tools[name] = fn(tool)
+	for version, versioned := range r.versions[name] {
+		r.versions[name][version] = fn(versioned)
+	}
+	return nil
+}
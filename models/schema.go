@@ -0,0 +1,114 @@
+package models
+
+import "fmt"
+
+// Schema is the subset of JSON Schema used to import tool definitions from
+// external sources such as MCP servers.
+type Schema struct {
+	Type        any                `json:"type,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Enum        []any              `json:"enum,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+}
+
+// ToParameters converts an object schema into tool parameters.
+func (s *Schema) ToParameters() *Parameters {
+	if s == nil || len(s.Properties) == 0 {
+		return nil
+	}
+
+	params := &Parameters{
+		Type:       "object",
+		Properties: make(map[string]*Parameter, len(s.Properties)),
+		Required:   s.Required,
+	}
+	for name, prop := range s.Properties {
+		params.Properties[name] = prop.ToParameter()
+	}
+	return params
+}
+
+// ToParameter converts a property schema into a single tool parameter.
+func (s *Schema) ToParameter() *Parameter {
+	if s == nil {
+		return &Parameter{Type: "string"}
+	}
+
+	param := &Parameter{
+		Type:        s.typeName(),
+		Description: s.Description,
+		Required:    s.Required,
+	}
+	for _, v := range s.Enum {
+		param.Enum = append(param.Enum, fmt.Sprint(v))
+	}
+	if s.Items != nil {
+		param.Items = s.Items.ToParameter()
+	}
+	if len(s.Properties) > 0 {
+		param.Properties = make(map[string]*Parameter, len(s.Properties))
+		for name, prop := range s.Properties {
+			param.Properties[name] = prop.ToParameter()
+		}
+	}
+	return param
+}
+
+// SchemaFromParameters converts tool parameters back into a JSON Schema. Tools
+// without parameters get an empty object schema.
+func SchemaFromParameters(p *Parameters) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	if p == nil {
+		return schema
+	}
+
+	schema.Required = p.Required
+	for name, param := range p.Properties {
+		schema.Properties[name] = schemaFromParameter(param)
+	}
+	return schema
+}
+
+func schemaFromParameter(p *Parameter) *Schema {
+	schema := &Schema{
+		Description: p.Description,
+		Required:    p.Required,
+	}
+	if p.Type != "" {
+		schema.Type = p.Type
+	}
+	for _, v := range p.Enum {
+		schema.Enum = append(schema.Enum, v)
+	}
+	if p.Items != nil {
+		schema.Items = schemaFromParameter(p.Items)
+	}
+	if len(p.Properties) > 0 {
+		schema.Properties = make(map[string]*Schema, len(p.Properties))
+		for name, prop := range p.Properties {
+			schema.Properties[name] = schemaFromParameter(prop)
+		}
+	}
+	return schema
+}
+
+// typeName returns the schema type, picking the first non-null entry when the
+// type is a list such as ["string", "null"].
+func (s *Schema) typeName() string {
+	switch t := s.Type.(type) {
+	case string:
+		return t
+	case []any:
+		for _, v := range t {
+			if name, ok := v.(string); ok && name != "null" {
+				return name
+			}
+		}
+	}
+	if len(s.Properties) > 0 {
+		return "object"
+	}
+	return "string"
+}